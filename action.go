@@ -126,6 +126,9 @@ func (a *action) delete(v *view) {
 }
 
 func (a *action) do(v *view, what action_type) {
+	for _, bv := range v.buf.views {
+		bv.drop_wrap_rows(a)
+	}
 	switch what {
 	case action_insert:
 		a.insert(v)
@@ -136,6 +139,9 @@ func (a *action) do(v *view, what action_type) {
 		if v.buf.is_mark_set() {
 			v.buf.mark.on_insert_adjust(a)
 		}
+		for _, w := range v.buf.watchers {
+			w.on_insert(a)
+		}
 	case action_delete:
 		a.delete(v)
 		v.on_delete_adjust_top_line(a)
@@ -145,7 +151,11 @@ func (a *action) do(v *view, what action_type) {
 		if v.buf.is_mark_set() {
 			v.buf.mark.on_delete_adjust(a)
 		}
+		for _, w := range v.buf.watchers {
+			w.on_delete(a)
+		}
 	}
+	v.update_gutter_width()
 	v.dirty = dirty_everything
 
 	// any change to the buffer causes words cache invalidation
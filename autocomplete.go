@@ -50,6 +50,11 @@ type ac_proposal struct {
 type (
 	ac_func        func(view *view) ([]ac_proposal, int)
 	ac_decide_func func(view *view) ac_func
+
+	// Filters and sorts proposals by the text typed after the
+	// autocompletion has started. With a filter function the typed text
+	// is replaced by the chosen proposal, instead of being completed.
+	ac_filter_func func(proposals []ac_proposal, filter []byte) []ac_proposal
 )
 
 type autocompl struct {
@@ -58,6 +63,7 @@ type autocompl struct {
 	current   cursor_location
 	proposals []ac_proposal
 	filtered  []ac_proposal
+	filter    ac_filter_func // nil means prefix filtering
 
 	// ui
 	cursor int
@@ -76,6 +82,18 @@ func new_autocompl(f ac_func, view *view) *autocompl {
 		return nil
 	}
 
+	ac.filter = view.ac_filter
+	if ac.filter != nil {
+		// keep the typed text, it becomes the filter
+		ac.origin = view.cursor
+		for ; charsback > 0; charsback-- {
+			ac.origin.move_one_rune_backward()
+		}
+		ac.current = ac.origin
+		ac.update(view.cursor)
+		return ac
+	}
+
 	if charsback > 0 {
 		origin := view.cursor
 
@@ -152,8 +170,17 @@ func (ac *autocompl) update(current cursor_location) bool {
 		return true
 	}
 
-	ac.filtered = ac.filtered[:0]
 	filter := bytes_between(ac.origin, ac.current)
+	if ac.filter != nil {
+		// the order may change completely, start from the top; no
+		// proposals is fine, more typing or deleting may bring them back
+		ac.filtered = ac.filter(ac.proposals, filter)
+		ac.cursor = 0
+		ac.view = 0
+		return true
+	}
+
+	ac.filtered = ac.filtered[:0]
 	j := 0
 	for i := 0; i < ac_max_filtered; i++ {
 		if j >= len(ac.proposals) {
@@ -300,6 +327,15 @@ func (ac *autocompl) finalize(view *view) {
 	if d < 0 {
 		panic("something went really wrong, oops..")
 	}
+	if len(ac.actual_proposals()) == 0 {
+		return
+	}
+	if ac.filter != nil {
+		// replace the typed text with the proposal
+		view.action_delete(ac.origin, d)
+		ac.current = ac.origin
+		d = 0
+	}
 	data := clone_byte_slice(ac.actual_proposals()[ac.cursor].content[d:])
 	view.action_insert(ac.current, data)
 	ac.current.boffset += len(data)
@@ -415,24 +451,23 @@ func make_godit_buffer_ac_decide(godit *godit) ac_decide_func {
 	}
 }
 
+// All the buffers ordered by the last visit, meant to be used with the fuzzy
+// filter (see 'fuzzy_ac_filter').
 func make_godit_buffer_ac(godit *godit) ac_func {
 	return func(view *view) ([]ac_proposal, int) {
-		prefix := string(view.buf.contents()[:view.cursor.boffset])
 		proposals := make([]ac_proposal, 0, 20)
-		for _, buf := range godit.buffers {
-			if strings.HasPrefix(buf.name, prefix) {
-				display := make([]byte, len(buf.name), len(buf.name)+5)
-				content := display
-				copy(display, buf.name)
-				if !buf.synced_with_disk() {
-					display = display[:len(display)+5]
-					copy(display[len(content):], " (**)")
-				}
-				proposals = append(proposals, ac_proposal{
-					display: display,
-					content: content,
-				})
+		for _, buf := range godit.buffers_by_visit() {
+			display := make([]byte, len(buf.name), len(buf.name)+5)
+			content := display
+			copy(display, buf.name)
+			if !buf.synced_with_disk() {
+				display = display[:len(display)+5]
+				copy(display[len(content):], " (**)")
 			}
+			proposals = append(proposals, ac_proposal{
+				display: display,
+				content: content,
+			})
 		}
 
 		return proposals, view.cursor_coffset
@@ -27,10 +27,13 @@ func init_autocomplete_mode(godit *godit) *autocomplete_mode {
 
 func (a *autocomplete_mode) substitute_next() {
 	view := a.godit.active.leaf
+	if view.check_read_only() {
+		return
+	}
 	if a.current != -1 {
 		// undo previous substitution
 		view.undo()
-		a.godit.set_status("") // hide undo status message
+		a.godit.echo("") // hide undo status message
 	}
 
 	a.current++
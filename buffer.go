@@ -53,6 +53,10 @@ type buffer struct {
 	on_disk    *action_group
 	mark       cursor_location
 
+	// when it's greater than zero, action groups are not finalized, see
+	// 'godit.with_single_undo_group'
+	undo_lock int
+
 	// absoulte path of the file, if it's empty string, then the file has no
 	// on-disk representation
 	path string
@@ -64,6 +68,25 @@ type buffer struct {
 	// cache for local buffer autocompletion
 	words_cache       llrb_tree
 	words_cache_valid bool
+
+	// the bigger the number, the more recently the buffer was visited,
+	// see 'godit.visit_buffer'
+	last_visit int
+
+	// special buffers only, see special_buffer.go
+	read_only bool
+	on_key    special_key_handler
+	on_kill   func() // see 'godit.kill_buffer'
+	highlight special_highlighter
+
+	// notified about all the changes, see 'action.do'
+	watchers []buffer_watcher
+}
+
+// Something that keeps track of buffer locations (but isn't a view).
+type buffer_watcher interface {
+	on_insert(a *action)
+	on_delete(a *action)
 }
 
 func new_empty_buffer() *buffer {
@@ -154,6 +177,19 @@ func (b *buffer) delete_view(v *view) {
 	}
 }
 
+func (b *buffer) add_watcher(w buffer_watcher) {
+	b.watchers = append(b.watchers, w)
+}
+
+func (b *buffer) delete_watcher(w buffer_watcher) {
+	for i, bw := range b.watchers {
+		if bw == w {
+			b.watchers = append(b.watchers[:i], b.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
 func (b *buffer) other_views(v *view, cb func(*view)) {
 	for _, ov := range b.views {
 		if v == ov {
@@ -208,6 +244,42 @@ func (b *buffer) dump_history() {
 	}
 }
 
+// Returns the line with the number 'n', the number is clamped to the valid
+// range.
+func (b *buffer) line_at(n int) (*line, int) {
+	l, num := b.first_line, 1
+	for num < n && l.next != nil {
+		l = l.next
+		num++
+	}
+	return l, num
+}
+
+// Makes a view location from line numbers and the cursor byte offset (e.g.
+// stored in a file), out of range values are clamped.
+func (b *buffer) location_at(line_num, boffset, top_line_num int) view_location {
+	var loc view_location
+	loc.cursor.line, loc.cursor.line_num = b.line_at(line_num)
+	if boffset > len(loc.cursor.line.data) {
+		boffset = len(loc.cursor.line.data)
+	}
+	if boffset < 0 {
+		boffset = 0
+	}
+	// make sure the offset is at the rune boundary
+	bo, _, _ := loc.cursor.line.find_closest_offsets(
+		vlen(loc.cursor.line.data[:boffset], 0))
+	loc.cursor.boffset = bo
+	loc.cursor_voffset, loc.cursor_coffset = loc.cursor.voffset_coffset()
+	loc.last_cursor_voffset = loc.cursor_voffset
+
+	if top_line_num > loc.cursor.line_num || top_line_num < 1 {
+		top_line_num = loc.cursor.line_num
+	}
+	loc.top_line, loc.top_line_num = b.line_at(top_line_num)
+	return loc
+}
+
 func (b *buffer) save() error {
 	return b.save_as(b.path)
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+)
+
+//----------------------------------------------------------------------------
+// buffer list
+//
+// The *Buffer List* buffer lists all the buffers, one per line, with their
+// flags (D - marked for kill, S - marked for save, * - modified). Keys: RET
+// visits a buffer, s and d (or k) mark it for save and kill, u unmarks it, x
+// executes the marks, g refreshes.
+//----------------------------------------------------------------------------
+
+const (
+	buffer_list_name         = "*Buffer List*"
+	buffer_list_header_lines = 2 // column names and an empty line
+)
+
+type buffer_list struct {
+	godit   *godit
+	buf     *buffer
+	entries []*buffer // the listed buffers in the order of lines
+	save    map[*buffer]bool
+	kill    map[*buffer]bool
+}
+
+func (g *godit) show_buffer_list() {
+	bl := &g.buffer_list
+	current := g.active.leaf.buf
+	if bl.godit == nil {
+		bl.godit = g
+		bl.save = make(map[*buffer]bool)
+		bl.kill = make(map[*buffer]bool)
+	}
+	bl.buf = g.special_buffer(buffer_list_name)
+	bl.buf.on_key = bl.on_key
+	bl.render()
+	v := g.active.leaf
+	v.attach(bl.buf)
+	bl.goto_entry(v, current)
+}
+
+func buffer_size(buf *buffer) int {
+	size := -1
+	for l := buf.first_line; l != nil; l = l.next {
+		size += len(l.data) + 1
+	}
+	return size
+}
+
+func (bl *buffer_list) format_entry(buf *buffer) string {
+	flags := []byte("   ")
+	if bl.kill[buf] {
+		flags[0] = 'D'
+	}
+	if bl.save[buf] {
+		flags[1] = 'S'
+	}
+	if !buf.synced_with_disk() {
+		flags[2] = '*'
+	}
+	return fmt.Sprintf("%s %-24s %9d  %s\n", flags, buf.name, buffer_size(buf),
+		abbreviate_home(buf.path))
+}
+
+// Rewrites the buffer contents, the views stay on their entries. Does
+// nothing if the *Buffer List* buffer was killed.
+func (bl *buffer_list) render() {
+	g := bl.godit
+	if !g.is_buffer_alive(bl.buf) {
+		return
+	}
+	current := make([]*buffer, len(bl.buf.views))
+	for i, v := range bl.buf.views {
+		current[i] = bl.entry_at(v.cursor.line_num)
+	}
+
+	bl.entries = append(bl.entries[:0], g.buffers...)
+	for _, m := range []map[*buffer]bool{bl.save, bl.kill} {
+		for b := range m {
+			if !g.is_buffer_alive(b) {
+				delete(m, b)
+			}
+		}
+	}
+	data := []byte(fmt.Sprintf("    %-24s %9s  %s\n\n", "Buffer", "Size", "File"))
+	for _, b := range bl.entries {
+		data = append(data, bl.format_entry(b)...)
+	}
+	g.set_special_buffer_contents(bl.buf, data)
+
+	for i, v := range bl.buf.views {
+		bl.goto_entry(v, current[i])
+	}
+}
+
+// Returns the buffer listed at the line 'n', nil if there is none.
+func (bl *buffer_list) entry_at(n int) *buffer {
+	i := n - buffer_list_header_lines - 1
+	if i < 0 || i >= len(bl.entries) {
+		return nil
+	}
+	return bl.entries[i]
+}
+
+// Moves the cursor to the entry, the first entry if there is no such one.
+func (bl *buffer_list) goto_entry(v *view, buf *buffer) {
+	n := 0
+	for i, b := range bl.entries {
+		if b == buf {
+			n = i
+			break
+		}
+	}
+	v.move_cursor_to_line(n + buffer_list_header_lines + 1)
+}
+
+func (bl *buffer_list) mark(v *view, m map[*buffer]bool) {
+	b := bl.entry_at(v.cursor.line_num)
+	if b == nil {
+		return
+	}
+	if m == nil {
+		delete(bl.save, b)
+		delete(bl.kill, b)
+	} else {
+		m[b] = true
+	}
+	bl.render()
+	v.on_vcommand(vcommand_move_cursor_next_line, 0)
+}
+
+// Saves the buffers marked for save, then kills the ones marked for kill.
+func (bl *buffer_list) execute() {
+	g := bl.godit
+	saved := 0
+	for _, b := range bl.entries {
+		if !bl.save[b] || !g.is_buffer_alive(b) {
+			continue
+		}
+		if b.path == "" {
+			g.set_error("(Buffer %s has no file)", b.name)
+			bl.render()
+			return
+		}
+		if err := g.save_buffer(b); err != nil {
+			g.set_error(err.Error())
+			bl.render()
+			return
+		}
+		delete(bl.save, b)
+		saved++
+	}
+
+	var kill []*buffer
+	for _, b := range bl.entries {
+		if bl.kill[b] && g.is_buffer_alive(b) {
+			kill = append(kill, b)
+		}
+	}
+	bl.render()
+	if len(kill) == 0 {
+		g.set_status("Saved %d buffers", saved)
+		return
+	}
+	g.confirm_kill_buffers(kill, func() {
+		bl.render()
+		g.set_status("Saved %d, killed %d buffers", saved, len(kill))
+	})
+}
+
+func (bl *buffer_list) on_key(v *view, ev *termbox.Event) bool {
+	g := bl.godit
+	if ev.Mod != 0 {
+		return false
+	}
+	if ev.Key == termbox.KeyEnter || ev.Key == termbox.KeyCtrlJ {
+		ev = &termbox.Event{Ch: 'f'}
+	}
+	switch ev.Ch {
+	case 'f':
+		b := bl.entry_at(v.cursor.line_num)
+		if b == nil || !g.is_buffer_alive(b) {
+			g.set_status("(No buffer on this line)")
+			break
+		}
+		v.attach(b)
+	case 'n':
+		v.on_vcommand(vcommand_move_cursor_next_line, 0)
+	case 'p':
+		v.on_vcommand(vcommand_move_cursor_prev_line, 0)
+	case 's':
+		bl.mark(v, bl.save)
+	case 'd', 'k':
+		bl.mark(v, bl.kill)
+	case 'u':
+		bl.mark(v, nil)
+	case 'x':
+		bl.execute()
+	case 'g':
+		bl.render()
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// commands
+//
+// Every key binding refers to a named command from the registry (see
+// keymap.go), the same commands can be invoked by name with M-x. There are
+// two kinds of commands: godit commands and view commands. The latter work in
+// any view, including the line edit mode ones, when invoked by name or from
+// the global keymaps they work on the active view.
+//----------------------------------------------------------------------------
+
+type command struct {
+	name string
+	desc string
+	do   func(g *godit) // godit command
+	view func(v *view)  // view command
+}
+
+var commands = make(map[string]*command)
+
+func def_command(name, desc string, do func(g *godit)) {
+	commands[name] = &command{name: name, desc: desc, do: do}
+}
+
+func def_view_command(name, desc string, do func(v *view)) {
+	commands[name] = &command{name: name, desc: desc, view: do}
+}
+
+func def_vcommand(name, desc string, cmd vcommand) {
+	def_view_command(name, desc, func(v *view) {
+		v.on_vcommand(cmd, 0)
+	})
+}
+
+func (g *godit) run_command(c *command) {
+	if c.view == nil {
+		c.do(g)
+		return
+	}
+	v := g.active.leaf
+	v.count = g.take_count()
+	c.view(v)
+	v.count = 0
+}
+
+// Human readable key bindings of the command, e.g. "C-x C-f".
+func command_keys(name string) string {
+	var keys []string
+	keys = append(keys, global_keymap.keys_of(name)...)
+	keys = append(keys, view_keymap.keys_of(name)...)
+	return strings.Join(keys, ", ")
+}
+
+func init() {
+	init_view_commands()
+	init_godit_commands()
+	init_ctrl_x_commands()
+	init_view_op_commands()
+	init_kmacro_commands()
+}
+
+//----------------------------------------------------------------------------
+// view commands
+//----------------------------------------------------------------------------
+
+func init_view_commands() {
+	def_vcommand("forward-char", "Move cursor one character forward",
+		vcommand_move_cursor_forward)
+	def_vcommand("backward-char", "Move cursor one character backward",
+		vcommand_move_cursor_backward)
+	def_view_command("next-line", "Move cursor to the next line", func(v *view) {
+		if v.ac != nil {
+			v.on_vcommand(vcommand_autocompl_move_cursor_down, 0)
+			return
+		}
+		v.on_vcommand(vcommand_move_cursor_next_line, 0)
+	})
+	def_view_command("previous-line", "Move cursor to the previous line", func(v *view) {
+		if v.ac != nil {
+			v.on_vcommand(vcommand_autocompl_move_cursor_up, 0)
+			return
+		}
+		v.on_vcommand(vcommand_move_cursor_prev_line, 0)
+	})
+	def_vcommand("move-end-of-line", "Move cursor to the end of line",
+		vcommand_move_cursor_end_of_line)
+	def_vcommand("move-beginning-of-line", "Move cursor to the beginning of line",
+		vcommand_move_cursor_beginning_of_line)
+	def_vcommand("forward-word", "Move cursor one word forward",
+		vcommand_move_cursor_word_forward)
+	def_vcommand("backward-word", "Move cursor one word backward",
+		vcommand_move_cursor_word_backward)
+	def_vcommand("beginning-of-buffer", "Move cursor to the beginning of file",
+		vcommand_move_cursor_beginning_of_file)
+	def_vcommand("end-of-buffer", "Move cursor to the end of file",
+		vcommand_move_cursor_end_of_file)
+	def_vcommand("scroll-up", "Move view forward (half of the screen)",
+		vcommand_move_view_half_forward)
+	def_vcommand("scroll-down", "Move view backward (half of the screen)",
+		vcommand_move_view_half_backward)
+	def_vcommand("recenter", "Center view on the cursor",
+		vcommand_recenter)
+	def_vcommand("undo", "Undo", vcommand_undo)
+	def_view_command("newline", "Insert a new line (or finish autocompletion)", func(v *view) {
+		if v.ac != nil {
+			v.on_vcommand(vcommand_autocompl_finalize, 0)
+			return
+		}
+		// '\r' doesn't cause autoindent
+		v.on_vcommand(vcommand_insert_rune, '\r')
+	})
+	def_view_command("newline-and-indent", "Insert a new line with autoindent (or finish autocompletion)", func(v *view) {
+		if v.ac != nil {
+			v.on_vcommand(vcommand_autocompl_finalize, 0)
+			return
+		}
+		v.on_vcommand(vcommand_insert_rune, '\n')
+	})
+	def_view_command("insert-tab", "Insert a tab character", func(v *view) {
+		v.on_vcommand(vcommand_insert_rune, '\t')
+	})
+	def_vcommand("delete-backward-char", "Delete the character before the cursor",
+		vcommand_delete_rune_backward)
+	def_vcommand("delete-char", "Delete the character under the cursor",
+		vcommand_delete_rune)
+	def_vcommand("kill-line", "Kill line",
+		vcommand_kill_line)
+	def_vcommand("kill-word", "Kill word",
+		vcommand_kill_word)
+	def_vcommand("backward-kill-word", "Kill word backwards",
+		vcommand_kill_word_backward)
+	def_view_command("set-mark", "Set mark", func(v *view) {
+		v.set_mark()
+	})
+	def_vcommand("exchange-point-and-mark", "Swap cursor and mark locations",
+		vcommand_swap_cursor_and_mark)
+	def_vcommand("kill-region", "Kill region (between the cursor and the mark)",
+		vcommand_kill_region)
+	def_vcommand("copy-region", "Copy region (between the cursor and the mark)",
+		vcommand_copy_region)
+	def_vcommand("yank", "Yank (aka paste)",
+		vcommand_yank)
+	def_vcommand("upcase-word", "Convert the following word to upper case",
+		vcommand_word_to_upper)
+	def_vcommand("downcase-word", "Convert the following word to lower case",
+		vcommand_word_to_lower)
+	def_vcommand("capitalize-word", "Convert the following word to title case",
+		vcommand_word_to_title)
+	def_vcommand("upcase-region", "Convert the region to upper case",
+		vcommand_region_to_upper)
+	def_vcommand("downcase-region", "Convert the region to lower case",
+		vcommand_region_to_lower)
+	def_vcommand("autocomplete", "Invoke buffer specific autocompletion menu",
+		vcommand_autocompl_init)
+	def_view_command("toggle-line-numbers", "Toggle line numbers in the view", func(v *view) {
+		v.toggle_line_numbers()
+	})
+	def_view_command("toggle-wrap", "Toggle line wrapping in the view (chars/words)", func(v *view) {
+		v.toggle_wrap()
+	})
+
+	km := view_keymap
+	km.bind("forward-char", "C-f", "<right>")
+	km.bind("backward-char", "C-b", "<left>")
+	km.bind("next-line", "C-n", "<down>")
+	km.bind("previous-line", "C-p", "<up>")
+	km.bind("move-end-of-line", "C-e", "<end>")
+	km.bind("move-beginning-of-line", "C-a", "<home>")
+	km.bind("forward-word", "M-f")
+	km.bind("backward-word", "M-b")
+	km.bind("beginning-of-buffer", "M-<")
+	km.bind("end-of-buffer", "M->")
+	km.bind("scroll-up", "C-v", "<pgdn>")
+	km.bind("scroll-down", "M-v", "<pgup>")
+	km.bind("recenter", "C-l")
+	km.bind("undo", "C-/")
+	km.bind("newline", "RET")
+	km.bind("newline-and-indent", "C-j")
+	km.bind("insert-tab", "TAB")
+	km.bind("delete-backward-char", "DEL")
+	km.bind("backward-kill-word", "M-DEL", "M-C-h")
+	km.bind("delete-char", "C-d", "<delete>")
+	km.bind("kill-line", "C-k")
+	km.bind("kill-word", "M-d")
+	km.bind("set-mark", "C-SPC")
+	km.bind("kill-region", "C-w")
+	km.bind("copy-region", "M-w")
+	km.bind("yank", "C-y")
+	km.bind("upcase-word", "M-u")
+	km.bind("downcase-word", "M-l")
+	km.bind("capitalize-word", "M-c")
+}
+
+//----------------------------------------------------------------------------
+// godit commands
+//----------------------------------------------------------------------------
+
+func init_godit_commands() {
+	def_command("isearch-forward", "Search forward incrementally", func(g *godit) {
+		g.set_overlay_mode(init_isearch_mode(g, false))
+	})
+	def_command("isearch-backward", "Search backward incrementally", func(g *godit) {
+		g.set_overlay_mode(init_isearch_mode(g, true))
+	})
+	def_command("universal-argument", "Universal argument for the next command", func(g *godit) {
+		g.set_overlay_mode(init_universal_argument_mode(g, -1))
+	})
+	def_command("goto-line", "Go to line", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.goto_line_lemp()))
+	})
+	def_command("complete-word", "Local words autocompletion", func(g *godit) {
+		g.set_overlay_mode(init_autocomplete_mode(g))
+	})
+	def_command("fill-region", "Fill region (lines between the cursor and the mark)", func(g *godit) {
+		g.set_overlay_mode(init_fill_region_mode(g))
+	})
+	def_command("occur", "List lines matching a regexp in the *occur* buffer", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.occur_lemp()))
+	})
+	def_command("execute-command", "Execute a command by name", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.execute_command_lemp()))
+	})
+	def_command("describe-key", "Describe what a key sequence does", func(g *godit) {
+		g.set_overlay_mode(init_describe_key_mode(g))
+	})
+	def_command("describe-bindings", "List all key bindings in the *help* buffer", func(g *godit) {
+		g.describe_bindings()
+	})
+
+	km := global_keymap
+	km.bind("isearch-forward", "C-s")
+	km.bind("isearch-backward", "C-r")
+	km.bind("universal-argument", "C-u")
+	km.bind("goto-line", "M-g")
+	km.bind("complete-word", "M-/")
+	km.bind("fill-region", "M-q")
+	km.bind("occur", "M-o")
+	km.bind("execute-command", "M-x")
+	km.bind("shell-command", "M-!")
+	km.bind("describe-key", "C-h k")
+	km.bind("describe-bindings", "C-h b")
+}
+
+//----------------------------------------------------------------------------
+// C-x commands
+//----------------------------------------------------------------------------
+
+func init_ctrl_x_commands() {
+	def_command("quit", "Quit from godit", func(g *godit) {
+		if !g.has_unsaved_buffers() {
+			g.quitflag = true
+			return
+		}
+		g.set_overlay_mode(init_key_press_mode(
+			g,
+			map[rune]func(){
+				'y': func() {
+					g.quitflag = true
+				},
+				'n': func() {},
+			},
+			0,
+			"Modified buffers exist; exit anyway? (y or n)",
+		))
+	})
+	def_command("find-file", "Open file", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.open_buffer_lemp()))
+	})
+	def_command("find-recent-file", "Open a recently opened file (fuzzy matching)", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.open_recent_file_lemp()))
+	})
+	def_command("find-project-file", "Find file in the project (fuzzy matching)", func(g *godit) {
+		g.find_project_file()
+	})
+	def_command("save-buffer", "Save file", func(g *godit) {
+		g.save_active_buffer(false)
+	})
+	def_command("save-buffer-raw", "Save file (raw)", func(g *godit) {
+		g.save_active_buffer(true)
+	})
+	def_command("write-file", "Save file as", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.save_as_buffer_lemp(false)))
+	})
+	def_command("write-file-raw", "Save file as (raw)", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.save_as_buffer_lemp(true)))
+	})
+	def_command("save-all-buffers", "Save all modified buffers", func(g *godit) {
+		g.save_all_buffers()
+	})
+	def_command("save-session", "Save the session (buffers, cursor positions and views)", func(g *godit) {
+		if err := g.save_session(); err != nil {
+			g.set_error(err.Error())
+			return
+		}
+		g.session = true
+		g.set_status("Session saved")
+	})
+	def_command("restore-session", "Restore the last saved session", func(g *godit) {
+		if err := g.restore_session(); err != nil {
+			g.set_error(err.Error())
+			return
+		}
+		g.session = true
+	})
+	def_command("redo", "Redo", func(g *godit) {
+		g.active.leaf.on_vcommand(vcommand_redo, 0)
+		g.set_overlay_mode(init_redo_mode(g))
+	})
+	def_command("replace-string", "Search & replace (within region)", func(g *godit) {
+		if !g.active.leaf.buf.is_mark_set() {
+			g.set_status("The mark is not set now, so there is no region")
+			return
+		}
+		g.set_overlay_mode(init_line_edit_mode(g, g.search_and_replace_lemp1(nil)))
+	})
+	def_command("replace-in-files", "Search & replace in files (glob or grep results)", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.replace_in_files_lemp()))
+	})
+	def_command("kill-view", "Kill active view", func(g *godit) {
+		g.kill_active_view()
+	})
+	def_command("kill-other-views", "Kill all views but active", func(g *godit) {
+		g.kill_all_views_but_active()
+	})
+	def_command("split-vertically", "Split active view vertically", func(g *godit) {
+		g.split_vertically()
+	})
+	def_command("split-horizontally", "Split active view horizontally", func(g *godit) {
+		g.split_horizontally()
+	})
+	def_command("other-view", "Make a sibling view active", func(g *godit) {
+		sibling := g.active.sibling()
+		if sibling != nil && sibling.leaf != nil {
+			g.active.leaf.deactivate()
+			g.active = sibling
+			g.active.leaf.activate()
+		}
+	})
+	def_command("switch-buffer", "Switch buffer", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.switch_buffer_lemp()))
+	})
+	def_command("kill-buffer", "Kill buffer", func(g *godit) {
+		g.confirm_kill_buffers([]*buffer{g.active.leaf.buf}, nil)
+	})
+	def_command("list-buffers", "List all buffers in the *Buffer List* buffer", func(g *godit) {
+		g.show_buffer_list()
+	})
+	def_command("start-kbd-macro", "Start keyboard macro recording", func(g *godit) {
+		g.start_recording()
+	})
+	def_command("end-kbd-macro", "Stop keyboard macro recording", func(g *godit) {
+		g.stop_recording()
+	})
+	def_command("call-last-kbd-macro", "Stop recording and execute the last keyboard macro", func(g *godit) {
+		g.stop_recording()
+		if len(g.keymacros) > 0 {
+			g.set_overlay_mode(init_macro_repeat_mode(g))
+		}
+	})
+	def_command("indent-region", "Indent region (lines between the cursor and the mark)", func(g *godit) {
+		g.set_overlay_mode(init_region_indent_mode(g, 1))
+	})
+	def_command("deindent-region", "Deindent region (lines between the cursor and the mark)", func(g *godit) {
+		g.set_overlay_mode(init_region_indent_mode(g, -1))
+	})
+	def_command("grep", "Grep the project for a string into the *grep* buffer", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.grep_lemp(false)))
+	})
+	def_command("grep-regexp", "Grep the project for a regexp into the *grep* buffer", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.grep_lemp(true)))
+	})
+	def_command("next-error", "Visit the next grep match", func(g *godit) {
+		g.next_grep_entry()
+	})
+	def_command("what-cursor-position", "Info about character under the cursor", func(g *godit) {
+		v := g.active.leaf
+		var r rune
+		if v.cursor.eol() {
+			r = '\n'
+		} else {
+			r, _ = v.cursor.rune_under()
+		}
+		cursor_ex := make_cursor_location_ex(v.cursor)
+		g.set_status("Char: %s (dec: %d, oct: %s, hex: %s), Cursor offset: %d bytes",
+			strconv.QuoteRune(r), r,
+			strconv.FormatInt(int64(r), 8),
+			strconv.FormatInt(int64(r), 16),
+			cursor_ex.abs_boffset)
+	})
+	def_command("shell-command", "Run a shell command, C-u inserts its output at the cursor", func(g *godit) {
+		insert := g.count != 0
+		g.count = 0
+		g.set_overlay_mode(init_line_edit_mode(g, g.shell_command_lemp(insert)))
+	})
+	def_command("dired", "Open the directory of the current buffer", func(g *godit) {
+		g.dired_current_dir()
+	})
+	def_command("term", "Run a shell in a new *term* buffer", func(g *godit) {
+		g.start_terminal()
+	})
+	def_command("term-toggle-mode", "Switch a *term* buffer between char and line mode", func(g *godit) {
+		g.toggle_terminal_mode()
+	})
+	def_command("filter-region", "Filter region through an external command", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.filter_region_lemp()))
+	})
+
+	km := global_keymap
+	km.bind("quit", "C-x C-c")
+	km.bind("exchange-point-and-mark", "C-x C-x")
+	km.bind("autocomplete", "C-x C-a")
+	km.bind("upcase-region", "C-x C-u")
+	km.bind("downcase-region", "C-x C-l")
+	km.bind("find-file", "C-x C-f")
+	km.bind("find-recent-file", "C-x f")
+	km.bind("find-project-file", "C-x p")
+	km.bind("save-buffer", "C-x C-s")
+	km.bind("save-buffer-raw", "C-x S")
+	km.bind("write-file", "C-x M-s")
+	km.bind("write-file-raw", "C-x M-S")
+	km.bind("save-all-buffers", "C-x s")
+	km.bind("save-session", "C-x M-w")
+	km.bind("restore-session", "C-x M-r")
+	km.bind("redo", "C-x C-/")
+	km.bind("replace-string", "C-x C-r")
+	km.bind("replace-in-files", "C-x R")
+	km.bind("kill-view", "C-x 0")
+	km.bind("kill-other-views", "C-x 1")
+	km.bind("split-vertically", "C-x 2")
+	km.bind("split-horizontally", "C-x 3")
+	km.bind("other-view", "C-x o")
+	km.bind("switch-buffer", "C-x b")
+	km.bind("kill-buffer", "C-x k")
+	km.bind("list-buffers", "C-x C-b")
+	km.bind("start-kbd-macro", "C-x (")
+	km.bind("end-kbd-macro", "C-x )")
+	km.bind("call-last-kbd-macro", "C-x e")
+	km.bind("indent-region", "C-x >")
+	km.bind("deindent-region", "C-x <")
+	km.bind("grep", "C-x g")
+	km.bind("grep-regexp", "C-x G")
+	km.bind("next-error", "C-x `")
+	km.bind("toggle-line-numbers", "C-x l")
+	km.bind("toggle-wrap", "C-x w")
+	km.bind("what-cursor-position", "C-x =")
+	km.bind("filter-region", "C-x !")
+	km.bind("dired", "C-x d")
+	km.bind("term", "C-x t")
+	km.bind("term-toggle-mode", "C-x C-j")
+}
+
+//----------------------------------------------------------------------------
+// view operations commands (C-x C-w), see view_op_mode.go
+//----------------------------------------------------------------------------
+
+func init_view_op_commands() {
+	def_command("move-split-right", "Expand/shrink active view to the right", func(g *godit) {
+		if node := g.active.nearest_hsplit(); node != nil {
+			node.step_resize(1)
+		}
+	})
+	def_command("move-split-left", "Expand/shrink active view to the left", func(g *godit) {
+		if node := g.active.nearest_hsplit(); node != nil {
+			node.step_resize(-1)
+		}
+	})
+	def_command("move-split-down", "Expand/shrink active view to the bottom", func(g *godit) {
+		if node := g.active.nearest_vsplit(); node != nil {
+			node.step_resize(1)
+		}
+	})
+	def_command("move-split-up", "Expand/shrink active view to the top", func(g *godit) {
+		if node := g.active.nearest_vsplit(); node != nil {
+			node.step_resize(-1)
+		}
+	})
+
+	km := global_keymap
+	km.bind("split-vertically", "C-x C-w v")
+	km.bind("split-horizontally", "C-x C-w h")
+	km.bind("kill-view", "C-x C-w k")
+	km.bind("move-split-right", "C-x C-w C-f", "C-x C-w <right>")
+	km.bind("move-split-left", "C-x C-w C-b", "C-x C-w <left>")
+	km.bind("move-split-down", "C-x C-w C-n", "C-x C-w <down>")
+	km.bind("move-split-up", "C-x C-w C-p", "C-x C-w <up>")
+}
+
+//----------------------------------------------------------------------------
+// keyboard macro commands (C-x C-k), see kmacro.go
+//----------------------------------------------------------------------------
+
+func init_kmacro_commands() {
+	def_command("name-last-kbd-macro", "Name the last keyboard macro", func(g *godit) {
+		if len(g.keymacros) == 0 {
+			g.set_error("(No keyboard macro defined)")
+			return
+		}
+		g.set_overlay_mode(init_line_edit_mode(g, g.name_kmacro_lemp()))
+	})
+	def_command("bind-kbd-macro", "Bind a keyboard macro to C-x C-k <0-9, A-Z>", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.bind_kmacro_lemp()))
+	})
+	def_command("execute-named-kbd-macro", "Execute a named keyboard macro", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.execute_kmacro_lemp()))
+	})
+	def_command("call-bound-kbd-macro", "Execute a keyboard macro bound to C-x C-k <key>", func(g *godit) {
+		g.call_bound_kmacro()
+	})
+	def_command("apply-macro-to-region-lines", "Apply the last keyboard macro to each line in the region", func(g *godit) {
+		g.apply_macro_to_region_lines()
+	})
+	def_command("edit-kbd-macro", "Edit a keyboard macro in a buffer", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.edit_kmacro_lemp()))
+	})
+	def_command("kmacro-insert-counter", "Insert keyboard macro counter", func(g *godit) {
+		g.insert_kmacro_counter()
+	})
+	def_command("kmacro-set-counter", "Set keyboard macro counter value", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.set_kmacro_counter_lemp()))
+	})
+	def_command("kmacro-set-format", "Set keyboard macro counter format", func(g *godit) {
+		g.set_overlay_mode(init_line_edit_mode(g, g.set_kmacro_counter_format_lemp()))
+	})
+	def_command("save-kbd-macros", "Save named keyboard macros", func(g *godit) {
+		if err := g.save_kmacros(); err != nil {
+			g.set_error(err.Error())
+			return
+		}
+		g.set_status("Wrote %s", config_path(kmacros_file))
+	})
+	def_command("load-kbd-macros", "Load named keyboard macros", func(g *godit) {
+		if err := g.load_kmacros(); err != nil {
+			g.set_error(err.Error())
+			return
+		}
+		g.set_status("Loaded %s", config_path(kmacros_file))
+	})
+
+	// C-x C-k <0-9, A-Z> are bound when macros are bound to them, see
+	// 'godit.bind_kmacro_key'
+	km := global_keymap
+	km.bind("name-last-kbd-macro", "C-x C-k n")
+	km.bind("bind-kbd-macro", "C-x C-k b")
+	km.bind("execute-named-kbd-macro", "C-x C-k x")
+	km.bind("apply-macro-to-region-lines", "C-x C-k r")
+	km.bind("edit-kbd-macro", "C-x C-k e")
+	km.bind("kmacro-insert-counter", "C-x C-k TAB")
+	km.bind("kmacro-set-counter", "C-x C-k C-c")
+	km.bind("kmacro-set-format", "C-x C-k C-f")
+	km.bind("save-kbd-macros", "C-x C-k s")
+	km.bind("load-kbd-macros", "C-x C-k l")
+}
+
+//----------------------------------------------------------------------------
+// execute command (M-x)
+//----------------------------------------------------------------------------
+
+func make_commands_ac_decide() ac_decide_func {
+	return func(*view) ac_func {
+		return func(view *view) ([]ac_proposal, int) {
+			names := make([]string, 0, len(commands))
+			for name := range commands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			proposals := make([]ac_proposal, len(names))
+			for i, name := range names {
+				display := name
+				if keys := command_keys(name); keys != "" {
+					display = fmt.Sprintf("%s (%s)", name, keys)
+				}
+				proposals[i] = ac_proposal{
+					display: []byte(display),
+					content: []byte(name),
+				}
+			}
+			return proposals, view.cursor_coffset
+		}
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) execute_command_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		ac_decide:      make_commands_ac_decide(),
+		ac_filter:      fuzzy_ac_filter,
+		prompt:         "M-x:",
+		init_autocompl: true,
+		history:        "command",
+
+		on_apply: func(buf *buffer) {
+			name := string(buf.contents())
+			c, ok := commands[name]
+			if !ok {
+				g.set_error("No such command: %s", name)
+				return
+			}
+			g.command_keys = nil
+			g.run_command(c)
+		},
+	}
+}
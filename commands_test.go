@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+import "github.com/nsf/termbox-go"
+
+func TestCommandsRegistry(t *testing.T) {
+	for name, c := range commands {
+		if c.name != name {
+			t.Errorf("%s: registered as %s", c.name, name)
+		}
+		if c.desc == "" {
+			t.Errorf("%s: no description", name)
+		}
+		if (c.do == nil) == (c.view == nil) {
+			t.Errorf("%s: must be either a godit or a view command", name)
+		}
+	}
+
+	keymaps := map[string]*keymap{
+		"global": global_keymap,
+		"view":   view_keymap,
+	}
+	for kmname, km := range keymaps {
+		for seq, name := range km.bindings {
+			if _, ok := commands[name]; !ok {
+				t.Errorf("%s keymap: %s is bound to unknown command %s",
+					kmname, seq, name)
+			}
+		}
+	}
+	for seq, name := range view_keymap.bindings {
+		if commands[name].view == nil {
+			t.Errorf("view keymap: %s is bound to non-view command %s", seq, name)
+		}
+		if global_keymap.is_prefix([]key_event{must_parse_key(t, seq)}) {
+			t.Errorf("view keymap: %s is shadowed by a global prefix", seq)
+		}
+	}
+}
+
+func must_parse_key(t *testing.T, s string) key_event {
+	k, err := parse_key_event(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeymapLookup(t *testing.T) {
+	events := map[string]termbox.Event{
+		"next-line":            {Key: termbox.KeyCtrlN},
+		"set-mark":             {Key: termbox.KeyCtrlSpace},
+		"backward-kill-word":   {Mod: termbox.ModAlt, Key: termbox.KeyBackspace2},
+		"forward-word":         {Mod: termbox.ModAlt, Ch: 'f'},
+		"beginning-of-buffer":  {Mod: termbox.ModAlt, Ch: '<'},
+		"delete-backward-char": {Key: termbox.KeyBackspace2},
+	}
+	for name, ev := range events {
+		c := view_keymap.lookup([]key_event{keymap_key(&ev)})
+		if c == nil || c.name != name {
+			t.Errorf("%v: expected %s, got %v", ev, name, c)
+		}
+	}
+
+	ev := termbox.Event{Ch: 'a'}
+	if c := view_keymap.lookup([]key_event{keymap_key(&ev)}); c != nil {
+		t.Errorf("'a' is expected to insert itself, got %s", c.name)
+	}
+}
+
+func TestKeymapPrefixes(t *testing.T) {
+	km := new_keymap()
+	km.bind("a", "C-c g", "C-c C-x g")
+	seq := func(s string) []key_event {
+		keys, err := parse_key_events(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+	for _, s := range []string{"C-c", "C-c C-x"} {
+		if !km.is_prefix(seq(s)) {
+			t.Errorf("%s: expected a prefix", s)
+		}
+	}
+	km.unset(seq("C-c C-x g"))
+	if km.is_prefix(seq("C-c C-x")) {
+		t.Error("C-c C-x: expected not to be a prefix after unset")
+	}
+	if !km.is_prefix(seq("C-c")) {
+		t.Error("C-c: expected to remain a prefix")
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// dired
+//
+// Directory buffers list the entries of a directory, one per line. Keys:
+// RET visits an entry, ^ visits the parent, g refreshes, m/u/U mark and
+// unmark, + and c create a directory and a file, R renames and D deletes the
+// marked entries (or the one under cursor, if none are marked).
+//----------------------------------------------------------------------------
+
+const dired_header_lines = 2 // directory name and an empty line
+
+type dired struct {
+	godit   *godit
+	buf     *buffer
+	dir     string
+	entries []os.FileInfo
+	marks   map[string]bool
+}
+
+// Returns the directory buffer for the directory (refreshed), creates one if
+// there is no such buffer.
+func (g *godit) dired_buffer(dir string) (*buffer, error) {
+	for _, d := range g.direds {
+		if d.dir == dir {
+			d.refresh()
+			return d.buf, nil
+		}
+	}
+
+	d := &dired{godit: g, dir: dir, marks: make(map[string]bool)}
+	entries, err := d.read()
+	if err != nil {
+		g.set_error(err.Error())
+		return nil, err
+	}
+	d.entries = entries
+
+	d.buf = new_empty_buffer()
+	d.buf.name = g.buffer_name(filepath.Base(dir) + string(filepath.Separator))
+	d.buf.read_only = true
+	d.buf.on_key = d.on_key
+	d.buf.on_kill = d.kill
+	g.buffers = append(g.buffers, d.buf)
+	g.direds = append(g.direds, d)
+	d.render()
+	return d.buf, nil
+}
+
+func (d *dired) read() ([]os.FileInfo, error) {
+	f, err := os.Open(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fis, err := readdir_stat(d.dir, f)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(filesystem_slice(fis))
+	return fis, nil
+}
+
+func (d *dired) kill() {
+	g := d.godit
+	for i, gd := range g.direds {
+		if gd == d {
+			g.direds = append(g.direds[:i], g.direds[i+1:]...)
+			break
+		}
+	}
+}
+
+func (d *dired) format_entry(fi os.FileInfo) string {
+	mark := ' '
+	if d.marks[fi.Name()] {
+		mark = '*'
+	}
+	name := fi.Name()
+	if fi.IsDir() {
+		name += string(filepath.Separator)
+	}
+	return fmt.Sprintf("%c %s %10d %s %s\n", mark, fi.Mode(), fi.Size(),
+		fi.ModTime().Format("2006-01-02 15:04"), name)
+}
+
+// Rewrites the buffer contents, the views stay on their entries.
+func (d *dired) render() {
+	names := make([]string, len(d.buf.views))
+	for i, v := range d.buf.views {
+		if fi := d.entry_at(v.cursor.line_num); fi != nil {
+			names[i] = fi.Name()
+		}
+	}
+
+	data := []byte(abbreviate_home(d.dir) + ":\n\n")
+	for _, fi := range d.entries {
+		data = append(data, d.format_entry(fi)...)
+	}
+	d.godit.set_special_buffer_contents(d.buf, data)
+	if len(d.entries) > 0 {
+		d.buf.loc = d.buf.location_at(dired_header_lines+1, 0, 1)
+	}
+
+	for i, v := range d.buf.views {
+		d.goto_entry(v, names[i])
+	}
+}
+
+func (d *dired) refresh() {
+	entries, err := d.read()
+	if err != nil {
+		d.godit.set_error(err.Error())
+		return
+	}
+	d.entries = entries
+	marks := make(map[string]bool)
+	for _, fi := range entries {
+		if d.marks[fi.Name()] {
+			marks[fi.Name()] = true
+		}
+	}
+	d.marks = marks
+	d.render()
+}
+
+// Returns the entry at the line 'n' of the buffer, nil if there is none.
+func (d *dired) entry_at(n int) os.FileInfo {
+	i := n - dired_header_lines - 1
+	if i < 0 || i >= len(d.entries) {
+		return nil
+	}
+	return d.entries[i]
+}
+
+// Moves the cursor to the entry, the first entry if there is no such one.
+func (d *dired) goto_entry(v *view, name string) {
+	n := 0
+	for i, fi := range d.entries {
+		if fi.Name() == name {
+			n = i
+			break
+		}
+	}
+	v.move_cursor_to_line(n + dired_header_lines + 1)
+}
+
+// Returns the names of the marked entries or the entry under cursor.
+func (d *dired) selection(v *view) []string {
+	var names []string
+	for _, fi := range d.entries {
+		if d.marks[fi.Name()] {
+			names = append(names, fi.Name())
+		}
+	}
+	if len(names) == 0 {
+		if fi := d.entry_at(v.cursor.line_num); fi != nil {
+			names = append(names, fi.Name())
+		}
+	}
+	return names
+}
+
+func (d *dired) path(name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(d.dir, name)
+}
+
+func (d *dired) visit(v *view, path string) {
+	buf, err := d.godit.new_buffer_from_file(path)
+	if err != nil {
+		return
+	}
+	v.attach(buf)
+}
+
+func (d *dired) mark(v *view, mark bool) {
+	fi := d.entry_at(v.cursor.line_num)
+	if fi == nil {
+		return
+	}
+	if mark {
+		d.marks[fi.Name()] = true
+	} else {
+		delete(d.marks, fi.Name())
+	}
+	d.render()
+	v.on_vcommand(vcommand_move_cursor_next_line, 0)
+}
+
+func (d *dired) on_key(v *view, ev *termbox.Event) bool {
+	g := d.godit
+	if ev.Mod != 0 {
+		return false
+	}
+	if ev.Key == termbox.KeyEnter || ev.Key == termbox.KeyCtrlJ {
+		ev = &termbox.Event{Ch: 'f'}
+	}
+	switch ev.Ch {
+	case 'f':
+		fi := d.entry_at(v.cursor.line_num)
+		if fi == nil {
+			g.set_status("(No file on this line)")
+			break
+		}
+		d.visit(v, d.path(fi.Name()))
+	case '^':
+		d.visit(v, filepath.Dir(d.dir))
+		for _, pd := range g.direds {
+			if pd.buf == v.buf {
+				pd.goto_entry(v, filepath.Base(d.dir))
+			}
+		}
+	case 'n':
+		v.on_vcommand(vcommand_move_cursor_next_line, 0)
+	case 'p':
+		v.on_vcommand(vcommand_move_cursor_prev_line, 0)
+	case 'g':
+		d.refresh()
+	case 'm':
+		d.mark(v, true)
+	case 'u':
+		d.mark(v, false)
+	case 'U':
+		d.marks = make(map[string]bool)
+		d.render()
+	case '+':
+		g.set_overlay_mode(init_line_edit_mode(g, d.create_lemp(v, true)))
+	case 'c':
+		g.set_overlay_mode(init_line_edit_mode(g, d.create_lemp(v, false)))
+	case 'R':
+		names := d.selection(v)
+		if len(names) == 0 {
+			g.set_status("(No file on this line)")
+			break
+		}
+		g.set_overlay_mode(init_line_edit_mode(g, d.rename_lemp(names)))
+	case 'D':
+		d.delete(d.selection(v))
+	default:
+		return false
+	}
+	return true
+}
+
+func (d *dired) delete(names []string) {
+	g := d.godit
+	if len(names) == 0 {
+		g.set_status("(No file on this line)")
+		return
+	}
+	prompt := fmt.Sprintf("Delete %d files? (y or n)", len(names))
+	if len(names) == 1 {
+		prompt = fmt.Sprintf("Delete %s? (y or n)", names[0])
+	}
+	g.set_overlay_mode(init_key_press_mode(
+		g,
+		map[rune]func(){
+			'y': func() {
+				deleted := 0
+				for _, name := range names {
+					if err := os.Remove(d.path(name)); err != nil {
+						g.set_error(err.Error())
+						break
+					}
+					deleted++
+				}
+				d.refresh()
+				if deleted == len(names) {
+					g.set_status("Deleted %d files", deleted)
+				}
+			},
+			'n': func() {},
+		},
+		0,
+		prompt,
+	))
+}
+
+// Keeps the open buffers of the renamed file pointing to it, if a directory
+// was renamed, the buffers of the files inside it as well.
+func (d *dired) renamed(from, to string) {
+	g := d.godit
+	moved := func(path string) (string, bool) {
+		if path == from {
+			return to, true
+		}
+		if strings.HasPrefix(path, from+string(filepath.Separator)) {
+			return to + path[len(from):], true
+		}
+		return "", false
+	}
+	for _, buf := range g.buffers {
+		if path, ok := moved(buf.path); ok {
+			buf.path = path
+			buf.name = ""
+			buf.name = g.buffer_name(filepath.Base(path))
+		}
+	}
+	for _, od := range g.direds {
+		if dir, ok := moved(od.dir); ok {
+			od.dir = dir
+		}
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (d *dired) rename_lemp(names []string) line_edit_mode_params {
+	g := d.godit
+	prompt := fmt.Sprintf("Move %d files to directory:", len(names))
+	initial := ""
+	if len(names) == 1 {
+		prompt = fmt.Sprintf("Rename %s to:", names[0])
+		initial = names[0]
+	}
+	return line_edit_mode_params{
+		ac_decide:       filesystem_line_ac_decide,
+		prompt:          prompt,
+		initial_content: initial,
+		history:         "file",
+
+		on_apply: func(buf *buffer) {
+			target := string(buf.contents())
+			if target == "" {
+				g.set_status("(Nothing to rename to)")
+				return
+			}
+			target = d.path(substitute_home(target))
+			fi, err := os.Stat(target)
+			into_dir := err == nil && fi.IsDir()
+			if len(names) > 1 && !into_dir {
+				g.set_error("%s is not a directory", target)
+				return
+			}
+
+			renamed := 0
+			for _, name := range names {
+				from, to := d.path(name), target
+				if into_dir {
+					to = filepath.Join(target, name)
+				}
+				if err := os.Rename(from, to); err != nil {
+					g.set_error(err.Error())
+					break
+				}
+				d.renamed(from, to)
+				renamed++
+			}
+			d.refresh()
+			if renamed == len(names) {
+				g.set_status("Renamed %d files", renamed)
+			}
+		},
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (d *dired) create_lemp(v *view, dir bool) line_edit_mode_params {
+	g := d.godit
+	prompt := "Create file:"
+	if dir {
+		prompt = "Create directory:"
+	}
+	return line_edit_mode_params{
+		prompt:  prompt,
+		history: "file",
+
+		on_apply: func(buf *buffer) {
+			name := string(buf.contents())
+			if name == "" {
+				g.set_status("(Nothing to create)")
+				return
+			}
+			path := d.path(substitute_home(name))
+			var err error
+			if dir {
+				err = os.MkdirAll(path, 0755)
+			} else {
+				var f *os.File
+				f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+				if err == nil {
+					f.Close()
+				}
+			}
+			if err != nil {
+				g.set_error(err.Error())
+				return
+			}
+			d.refresh()
+			if filepath.Dir(path) == d.dir {
+				d.goto_entry(v, filepath.Base(path))
+			}
+			g.set_status("Created %s", path)
+		},
+	}
+}
+
+func (g *godit) dired_current_dir() {
+	dir := "."
+	if path := g.active.leaf.buf.path; path != "" {
+		dir = filepath.Dir(path)
+	}
+	for _, d := range g.direds {
+		if d.buf == g.active.leaf.buf {
+			dir = d.dir
+		}
+	}
+	buf, err := g.dired_buffer(abs_path(dir))
+	if err != nil {
+		return
+	}
+	g.active.leaf.attach(buf)
+}
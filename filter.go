@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"os"
+	"os/exec"
+	"time"
+)
+
+//----------------------------------------------------------------------------
+// filter region
+//
+// Replaces the region with the output of an external command, which gets the
+// region on its stdin. The command runs in background, the region is watched
+// while it runs and the output is discarded if the region was changed in the
+// meantime. Stderr goes to the *filter errors* buffer, C-g kills the command.
+// Keyboard macros pause until the command finishes, see 'wait_filter_in_macro'.
+//----------------------------------------------------------------------------
+
+const (
+	filter_errors_buffer_name = "*filter errors*"
+	filter_timeout            = 30 * time.Second
+)
+
+type filter_state struct {
+	command  string
+	buf      *buffer
+	beg, end cursor_location // the region, adjusted on changes
+	orig     []byte          // contents of the region when the command started
+	cancel   chan struct{}   // nil if there is no command running
+	process  *os.Process
+}
+
+func (f *filter_state) on_insert(a *action) {
+	f.beg.on_insert_adjust(a)
+	f.end.on_insert_adjust(a)
+}
+
+func (f *filter_state) on_delete(a *action) {
+	f.beg.on_delete_adjust(a)
+	f.end.on_delete_adjust(a)
+}
+
+func (f *filter_state) reset() {
+	f.buf.delete_watcher(f)
+	*f = filter_state{}
+}
+
+func (g *godit) start_filter(v *view, cmdstr string) {
+	if v.check_read_only() {
+		return
+	}
+	if !v.buf.is_mark_set() {
+		g.set_error("The mark is not set now, so there is no region")
+		return
+	}
+	g.stop_filter()
+
+	beg, end := v.region()
+	data := beg.extract_bytes(beg.distance(end))
+
+	// TODO: not portable
+	cmd := exec.Command("/bin/sh", "-c", cmdstr)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	set_process_group(cmd)
+	if err := cmd.Start(); err != nil {
+		g.set_error(err.Error())
+		return
+	}
+
+	fs := &g.filter
+	fs.command = cmdstr
+	fs.buf = v.buf
+	fs.beg, fs.end = beg, end
+	fs.orig = data
+	fs.process = cmd.Process
+	cancel := make(chan struct{})
+	fs.cancel = cancel
+	v.buf.add_watcher(fs)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	g.set_status("Filtering region through %s...", cmdstr)
+	go func() {
+		ok, err := wait_filter(cmd.Process, done, cancel)
+		if !ok {
+			return
+		}
+		g.run_async(func() {
+			if g.filter.cancel != cancel {
+				return // killed in the meantime
+			}
+			g.finish_filter(stdout.Bytes(), stderr.Bytes(), err)
+		}, cancel)
+	}()
+}
+
+// Waits for the command to exit, kills it on timeout. Returns false if the
+// wait was cancelled.
+func wait_filter(p *os.Process, done <-chan error, cancel <-chan struct{}) (bool, error) {
+	select {
+	case err := <-done:
+		return true, err
+	case <-time.After(filter_timeout):
+		// the children of the shell would keep the output pipes open
+		kill_process_group(p)
+		<-done
+		return true, fmt.Errorf("timed out after %s", filter_timeout)
+	case <-cancel:
+		return false, nil
+	}
+}
+
+func (g *godit) finish_filter(out, errout []byte, err error) {
+	fs := &g.filter
+	buf, beg, end, orig := fs.buf, fs.beg, fs.end, fs.orig
+	fs.reset()
+
+	note := ""
+	if len(errout) > 0 {
+		g.set_special_buffer_contents(g.special_buffer(filter_errors_buffer_name), errout)
+		note = " (see " + filter_errors_buffer_name + ")"
+	}
+	if err != nil {
+		msg := "Filter failed: " + err.Error()
+		if i := bytes.IndexByte(errout, '\n'); i != -1 {
+			msg += ": " + string(errout[:i])
+		} else if len(errout) > 0 {
+			msg += ": " + string(errout)
+		}
+		g.set_error("%s", msg)
+		return
+	}
+
+	if !g.is_buffer_alive(buf) || beg.distance(end) != len(orig) ||
+		!bytes.Equal(beg.extract_bytes(len(orig)), orig) {
+		g.set_error("(Region was changed while filtering, output discarded)")
+		return
+	}
+
+	var v *view
+	switch {
+	case g.active.leaf.buf == buf:
+		v = g.active.leaf
+	case len(buf.views) > 0:
+		v = buf.views[0]
+	default:
+		v = new_view(g.view_context(), buf)
+		defer v.detach()
+	}
+	v.finalize_action_group()
+	v.filter_text(beg, end, func([]byte) []byte {
+		return out
+	})
+	v.finalize_action_group()
+	g.set_status("Filtered region%s", note)
+}
+
+// Pauses keyboard macro execution until the filter command finishes, the next
+// keys of the macro may depend on its result. The screen is updated and the
+// background work goes on meanwhile, C-g kills the command and stops the
+// macro, other keys are ignored.
+func (g *godit) wait_filter_in_macro() {
+	for g.filter.cancel != nil {
+		g.draw()
+		termbox.Flush()
+		select {
+		case ev := <-g.termbox_event:
+			switch ev.Type {
+			case termbox.EventResize:
+				g.handle_event(&ev)
+			case termbox.EventKey:
+				if ev.Key == termbox.KeyCtrlG {
+					g.stop_filter()
+					g.macro_error = true
+				}
+			}
+		case f := <-g.async:
+			f()
+		}
+	}
+}
+
+// Kills the filter command in progress, if there is one.
+func (g *godit) stop_filter() {
+	fs := &g.filter
+	if fs.cancel == nil {
+		return
+	}
+	close(fs.cancel)
+	kill_process_group(fs.process)
+	fs.reset()
+	g.set_status("Filter killed")
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) filter_region_lemp() line_edit_mode_params {
+	v := g.active.leaf
+	return line_edit_mode_params{
+		ac_decide: filesystem_line_ac_decide,
+		prompt:    "Filter region through:",
+		history:   "shell",
+		on_apply: func(linebuf *buffer) {
+			g.start_filter(v, string(linebuf.contents()))
+		},
+	}
+}
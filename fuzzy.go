@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+//----------------------------------------------------------------------------
+// fuzzy matching
+//
+// A pattern matches a string if all of the pattern runes appear in the string
+// in the same order (case insensitive). Matches are scored, so that
+// consecutive runes, word starts and matches within the last path component
+// are preferred.
+//----------------------------------------------------------------------------
+
+const (
+	fuzzy_match_bonus       = 1
+	fuzzy_consecutive_bonus = 5
+	fuzzy_word_start_bonus  = 3
+	fuzzy_basename_bonus    = 2
+)
+
+func is_fuzzy_separator(r rune) bool {
+	switch r {
+	case '/', '\\', '_', '-', '.', ' ':
+		return true
+	}
+	return false
+}
+
+// Returns the score of the 'pattern' matching the 'str' or -1 if there is no
+// match. An empty pattern matches everything with the zero score.
+//
+// The match is greedy and goes from the end of the string, that way the last
+// path component is matched first.
+func fuzzy_score(str, pattern []byte) int {
+	score := 0
+	basename := true
+	prev_matched := false
+	si, pi := len(str), len(pattern)
+	for pi > 0 {
+		if si == 0 {
+			return -1
+		}
+		pr, prlen := utf8.DecodeLastRune(pattern[:pi])
+		sr, srlen := utf8.DecodeLastRune(str[:si])
+		si -= srlen
+
+		if unicode.ToLower(sr) != unicode.ToLower(pr) {
+			if sr == '/' {
+				basename = false
+			}
+			prev_matched = false
+			continue
+		}
+		pi -= prlen
+
+		score += fuzzy_match_bonus
+		if prev_matched {
+			score += fuzzy_consecutive_bonus
+		}
+		if si == 0 {
+			score += fuzzy_word_start_bonus
+		} else if r, _ := utf8.DecodeLastRune(str[:si]); is_fuzzy_separator(r) {
+			score += fuzzy_word_start_bonus
+		}
+		if basename {
+			score += fuzzy_basename_bonus
+		}
+		if sr == '/' {
+			basename = false
+		}
+		prev_matched = true
+	}
+	return score
+}
+
+type fuzzy_match struct {
+	index int // index in the original slice
+	score int
+}
+
+// Matches the 'pattern' against 'n' strings given by the 'str' function.
+// Returns the matches sorted by score, matches with the same score keep the
+// original order.
+func fuzzy_filter(n int, str func(i int) []byte, pattern []byte) []fuzzy_match {
+	matches := make([]fuzzy_match, 0, n)
+	for i := 0; i < n; i++ {
+		score := fuzzy_score(str(i), pattern)
+		if score >= 0 {
+			matches = append(matches, fuzzy_match{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	return matches
+}
+
+// Autocompletion filter function (see 'ac_filter_func') for fuzzy matching.
+func fuzzy_ac_filter(proposals []ac_proposal, filter []byte) []ac_proposal {
+	matches := fuzzy_filter(len(proposals), func(i int) []byte {
+		return proposals[i].content
+	}, filter)
+
+	filtered := make([]ac_proposal, 0, len(matches))
+	for _, m := range matches {
+		if len(filtered) == ac_max_filtered {
+			break
+		}
+		filtered = append(filtered, proposals[m.index])
+	}
+	return filtered
+}
+
+// Merges two sorted (see 'fuzzy_filter') slices of matches, for equal scores
+// matches from 'a' go first.
+func merge_fuzzy_matches(a, b []fuzzy_match) []fuzzy_match {
+	merged := make([]fuzzy_match, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if b[0].score > a[0].score {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
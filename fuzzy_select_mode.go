@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"github.com/nsf/tulib"
+	"unicode/utf8"
+)
+
+//----------------------------------------------------------------------------
+// fuzzy select mode
+//
+// Selects one of the items with a fuzzy filtered list shown above the command
+// line. Items may be added while the mode is active (e.g. by a background
+// goroutine), the list is updated live.
+//----------------------------------------------------------------------------
+
+const fuzzy_select_max_lines = 10
+
+type fuzzy_select_mode struct {
+	stub_overlay_mode
+	godit     *godit
+	linebuf   *buffer
+	lineview  *view
+	prompt    string
+	prompt_w  int
+	items     []string
+	matches   []fuzzy_match
+	pattern   []byte
+	cursor    int  // selected match
+	top       int  // first visible match
+	done      bool // all the items are there
+	on_select func(item string)
+	on_exit   func()
+}
+
+func init_fuzzy_select_mode(godit *godit, prompt string) *fuzzy_select_mode {
+	m := new(fuzzy_select_mode)
+	m.godit = godit
+	m.prompt = prompt
+	m.linebuf = new_empty_buffer()
+	m.lineview = new_view(godit.view_context(), m.linebuf)
+	m.lineview.oneline = true
+	m.lineview.ac_decide = nil
+	return m
+}
+
+// Adds more items, 'done' tells that there will be no more items.
+func (m *fuzzy_select_mode) add_items(items []string, done bool) {
+	first := len(m.items)
+	m.items = append(m.items, items...)
+	m.done = done
+
+	matches := fuzzy_filter(len(items), func(i int) []byte {
+		return []byte(items[i])
+	}, m.pattern)
+	for i := range matches {
+		matches[i].index += first
+	}
+	m.matches = merge_fuzzy_matches(m.matches, matches)
+}
+
+func (m *fuzzy_select_mode) refilter() {
+	m.matches = fuzzy_filter(len(m.items), func(i int) []byte {
+		return []byte(m.items[i])
+	}, m.pattern)
+	m.cursor = 0
+	m.top = 0
+}
+
+func (m *fuzzy_select_mode) exit() {
+	if m.on_exit != nil {
+		m.on_exit()
+	}
+}
+
+func (m *fuzzy_select_mode) on_key(ev *termbox.Event) {
+	g := m.godit
+	switch ev.Key {
+	case termbox.KeyCtrlN, termbox.KeyArrowDown:
+		if m.cursor < len(m.matches)-1 {
+			m.cursor++
+		}
+	case termbox.KeyCtrlP, termbox.KeyArrowUp:
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case termbox.KeyEnter, termbox.KeyCtrlJ:
+		if len(m.matches) == 0 {
+			g.set_status("(No match)")
+			return
+		}
+		item := m.items[m.matches[m.cursor].index]
+		g.set_overlay_mode(nil)
+		m.on_select(item)
+	case termbox.KeyTab:
+		// no autocompletion here
+	default:
+		m.lineview.on_key(ev)
+		pattern := m.linebuf.contents()
+		if string(pattern) != string(m.pattern) {
+			m.pattern = pattern
+			m.refilter()
+		}
+	}
+}
+
+func (m *fuzzy_select_mode) full_prompt() []byte {
+	more := ""
+	if !m.done {
+		more = "+"
+	}
+	return []byte(fmt.Sprintf("%s [%d/%d%s]:", m.prompt, len(m.matches),
+		len(m.items), more))
+}
+
+func (m *fuzzy_select_mode) draw() {
+	ui := m.godit.uibuf
+	prompt := m.full_prompt()
+	m.prompt_w = utf8.RuneCount(prompt)
+
+	// prompt and the line view
+	prompt_r := tulib.Rect{0, ui.Height - 1, m.prompt_w + 1, 1}
+	ui.Fill(prompt_r, termbox.Cell{
+		Fg: termbox.ColorDefault,
+		Bg: termbox.ColorDefault,
+		Ch: ' ',
+	})
+	lp := default_label_params
+	lp.Fg = termbox.ColorCyan
+	ui.DrawLabel(prompt_r, &lp, prompt)
+
+	m.lineview.resize(ui.Width-m.prompt_w-1, 1)
+	m.lineview.draw()
+	line_r := tulib.Rect{
+		m.prompt_w + 1, ui.Height - 1,
+		m.lineview.uibuf.Width, m.lineview.uibuf.Height,
+	}
+	ui.Blit(line_r, 0, 0, &m.lineview.uibuf)
+
+	// matches, the best one is on top
+	h := len(m.matches)
+	if h > fuzzy_select_max_lines {
+		h = fuzzy_select_max_lines
+	}
+	if h > ui.Height-1 {
+		h = ui.Height - 1
+	}
+	if h <= 0 {
+		return
+	}
+	if m.cursor < m.top {
+		m.top = m.cursor
+	} else if m.cursor >= m.top+h {
+		m.top = m.cursor - h + 1
+	}
+
+	r := tulib.Rect{0, ui.Height - 1 - h, ui.Width, 1}
+	for i := m.top; i < m.top+h && i < len(m.matches); i++ {
+		lp.Fg = termbox.ColorBlack
+		lp.Bg = termbox.ColorWhite
+		if i == m.cursor {
+			lp.Fg = termbox.ColorWhite
+			lp.Bg = termbox.ColorBlue
+		}
+		ui.Fill(r, termbox.Cell{Fg: lp.Fg, Bg: lp.Bg, Ch: ' '})
+		ui.DrawLabel(r, &lp, []byte(m.items[m.matches[i].index]))
+		r.Y++
+	}
+}
+
+func (m *fuzzy_select_mode) needs_cursor() bool {
+	return true
+}
+
+func (m *fuzzy_select_mode) cursor_position() (int, int) {
+	lx, ly := m.lineview.cursor_position()
+	return m.prompt_w + 1 + lx, m.godit.uibuf.Height - 1 + ly
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	no_match := []struct{ str, pattern string }{
+		{"godit.go", "gx"},
+		{"view.go", "viewgo."},
+		{"", "a"},
+	}
+	for _, c := range no_match {
+		if s := fuzzy_score([]byte(c.str), []byte(c.pattern)); s != -1 {
+			t.Errorf("%q matches %q with score %d", c.pattern, c.str, s)
+		}
+	}
+
+	better := []struct{ str1, str2, pattern string }{
+		// consecutive
+		{"/src/view.go", "/src/v_i_e_w.go", "view"},
+		// basename
+		{"/src/other/godit.go", "/src/godit/other.go", "godit"},
+		// word start
+		{"/src/e_d.go", "/src/exd.go", "ed"},
+		// case insensitive
+		{"/src/README", "/src/rxexaxdxmxe", "readme"},
+	}
+	for _, c := range better {
+		s1 := fuzzy_score([]byte(c.str1), []byte(c.pattern))
+		s2 := fuzzy_score([]byte(c.str2), []byte(c.pattern))
+		if s1 <= s2 {
+			t.Errorf("%q: expected %q (%d) to be better than %q (%d)",
+				c.pattern, c.str1, s1, c.str2, s2)
+		}
+	}
+}
+
+func TestFuzzyFilterStable(t *testing.T) {
+	strs := []string{"b/x.go", "a/x.go", "c/y.go"}
+	matches := fuzzy_filter(len(strs), func(i int) []byte {
+		return []byte(strs[i])
+	}, []byte("x"))
+	if len(matches) != 2 || matches[0].index != 0 || matches[1].index != 1 {
+		t.Errorf("unexpected matches: %v", matches)
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"github.com/nsf/termbox-go"
 	"github.com/nsf/tulib"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 )
 
@@ -59,17 +60,92 @@ type godit struct {
 	quitflag          bool
 	overlay           overlay_mode
 	termbox_event     chan termbox.Event
+	async             chan func() // see 'run_async'
 	keymacros         []key_event
+	keymacros_cmd     int                    // length of 'keymacros' before the current command
+	kmacros           map[string][]key_event // named keyboard macros
+	kmacro_bindings   map[rune]string        // C-x C-k <key> -> macro name
+	kmacro_edits      map[*buffer]string     // see 'edit_kmacro'
 	recording         bool
 	killbuffer        []byte
 	isearch_last_word []byte
 	s_and_r_last_word []byte
 	s_and_r_last_repl []byte
+
+	// universal argument (C-u), zero means there is no argument
+	count int
+
+	// key sequence which invoked the running command, nil for M-x
+	command_keys []key_event
+
+	// the session is saved on exit only if it was restored or saved
+	// explicitly, otherwise an unrelated run would overwrite it
+	session bool
+
+	// set by 'set_error', terminates keyboard macro execution
+	macro_error bool
+	replaying   int // > 0 while a keyboard macro is being executed
+
+	// keyboard macro counter, see 'insert_kmacro_counter'
+	kmacro_counter        int
+	kmacro_counter_format string
+	kmacro_counter_used   bool
+
+	// mouse dragging state, see 'on_mouse'
+	drag mouse_drag
+
+	// remembered cursor positions in files, see places.go
+	places map[string]place
+
+	// buffer visits counter, see 'visit_buffer'
+	visits int
+
+	// project-wide search, see grep.go
+	grep grep_state
+
+	// lines matching a regexp in a buffer, see occur.go
+	occur occur_state
+
+	// project walk of replace in files, see 'replace_files'
+	replace_walk chan struct{}
+
+	// line edit mode inputs by prompt kind, see history.go
+	history       map[string][]string
+	history_added []history_entry // see 'save_history'
+
+	// shell command running in background, see shell.go
+	shell shell_state
+
+	// region filter command running in background, see filter.go
+	filter filter_state
+
+	// shells running in *term* buffers, see terminal.go
+	terms []*terminal
+
+	// directory buffers, see dired.go
+	direds []*dired
+
+	// marks of the *Buffer List* buffer, see buffer_list.go
+	buffer_list buffer_list
+
+	// status messages log, see messages.go
+	messages messages_state
 }
 
 func new_godit(filenames []string) *godit {
 	g := new(godit)
 	g.buffers = make([]*buffer, 0, 20)
+	g.async = make(chan func(), 20)
+	places, err := load_places()
+	if err != nil {
+		g.set_status(err.Error())
+	}
+	g.places = places
+	history, err := load_history()
+	if err != nil {
+		g.set_status(err.Error())
+	}
+	g.history = history
 	for _, filename := range filenames {
 		g.new_buffer_from_file(filename)
 	}
@@ -81,11 +157,27 @@ func new_godit(filenames []string) *godit {
 	g.views = new_view_tree_leaf(nil, new_view(g.view_context(), g.buffers[0]))
 	g.active = g.views
 	g.keymacros = make([]key_event, 0, 50)
+	g.kmacros = make(map[string][]key_event)
+	g.kmacro_bindings = make(map[rune]string)
+	g.kmacro_edits = make(map[*buffer]string)
+	g.kmacro_counter_format = "%d"
+	if err := g.load_kmacros(); err != nil {
+		g.set_status(err.Error())
+	}
+	if err := load_keys(); err != nil {
+		g.set_status(err.Error())
+	}
 	g.isearch_last_word = make([]byte, 0, 32)
 	return g
 }
 
 func (g *godit) kill_buffer(buf *buffer) {
+	delete(g.kmacro_edits, buf)
+	g.remember_place(buf)
+	if buf.on_kill != nil {
+		buf.on_kill()
+	}
+
 	var replacement *buffer
 	views := make([]*view, len(buf.views))
 	copy(views, buf.views)
@@ -129,6 +221,53 @@ func (g *godit) kill_buffer(buf *buffer) {
 	g.buffers = g.buffers[:len(g.buffers)-1]
 }
 
+// Kills the buffers, asks for a confirmation first if some of them are
+// modified. 'done' (may be nil) is called after the buffers are killed.
+func (g *godit) confirm_kill_buffers(bufs []*buffer, done func()) {
+	kill := func() {
+		for _, b := range bufs {
+			g.kill_buffer(b)
+		}
+		if done != nil {
+			done()
+		}
+	}
+
+	var modified []*buffer
+	for _, b := range bufs {
+		if !b.synced_with_disk() {
+			modified = append(modified, b)
+		}
+	}
+	if len(modified) == 0 {
+		kill()
+		return
+	}
+	prompt := fmt.Sprintf("%d buffers modified; kill anyway? (y or n)", len(modified))
+	if len(modified) == 1 {
+		prompt = "Buffer " + modified[0].name + " modified; kill anyway? (y or n)"
+	}
+	g.set_overlay_mode(init_key_press_mode(
+		g,
+		map[rune]func(){
+			'y': kill,
+			'n': func() {},
+		},
+		0,
+		prompt,
+	))
+}
+
+// Returns false if the buffer was killed.
+func (g *godit) is_buffer_alive(buf *buffer) bool {
+	for _, b := range g.buffers {
+		if b == buf {
+			return true
+		}
+	}
+	return false
+}
+
 func (g *godit) find_buffer_by_full_path(path string) *buffer {
 	for _, buf := range g.buffers {
 		if buf.path == path {
@@ -188,7 +327,10 @@ func (g *godit) new_buffer_from_file(filename string) (*buffer, error) {
 		return buf, nil
 	}
 
-	_, err := os.Stat(fullpath)
+	fi, err := os.Stat(fullpath)
+	if err == nil && fi.IsDir() {
+		return g.dired_buffer(fullpath)
+	}
 	if err != nil {
 		// assume the file is just not there
 		g.set_status("(New file)")
@@ -206,6 +348,10 @@ func (g *godit) new_buffer_from_file(filename string) (*buffer, error) {
 			return nil, err
 		}
 		buf.path = fullpath
+		g.restore_place(buf)
+		if err := add_recent_file(fullpath); err != nil {
+			g.set_status(err.Error())
+		}
 	}
 
 	buf.name = g.buffer_name(filename)
@@ -213,11 +359,26 @@ func (g *godit) new_buffer_from_file(filename string) (*buffer, error) {
 	return buf, nil
 }
 
-func (g *godit) set_status(format string, args ...interface{}) {
+// Shows the message in the status line without recording it, used for
+// prompts and key echoes.
+func (g *godit) echo(format string, args ...interface{}) {
 	g.statusbuf.Reset()
 	fmt.Fprintf(&g.statusbuf, format, args...)
 }
 
+// Shows the message in the status line and records it in *Messages*.
+func (g *godit) set_status(format string, args ...interface{}) {
+	g.echo(format, args...)
+	g.log_message(g.statusbuf.String())
+}
+
+// Same as 'set_status', but also signals an error, which stops keyboard macro
+// execution.
+func (g *godit) set_error(format string, args ...interface{}) {
+	g.set_status(format, args...)
+	g.macro_error = true
+}
+
 func (g *godit) split_horizontally() {
 	if g.active.Width == 0 {
 		return
@@ -276,6 +437,11 @@ func (g *godit) resize() {
 	views_area := g.uibuf.Rect
 	views_area.Height -= 1 // reserve space for command line
 	g.views.resize(views_area)
+	for _, t := range g.terms {
+		if v := t.view(); v != nil {
+			t.resize(v)
+		}
+	}
 }
 
 func (g *godit) draw_autocompl() {
@@ -367,43 +533,64 @@ func (g *godit) on_sys_key(ev *termbox.Event) {
 	case termbox.KeyCtrlG:
 		v := g.active.leaf
 		v.ac = nil
+		g.count = 0
+		in_overlay := g.overlay != nil
 		g.set_overlay_mode(nil)
 		g.set_status("Quit")
+		if !in_overlay {
+			// C-g outside of any mode cancels the grep and the file
+			// search of replace in files, kills the shell and filter
+			// commands in progress
+			g.stop_grep()
+			g.stop_replace_walk()
+			g.stop_shell_command()
+			g.stop_filter()
+			g.stop_grep()
+			g.stop_replace_walk()
+			g.stop_shell_command()
+			g.stop_filter()
+		}
 	case termbox.KeyCtrlZ:
-		suspend(g)
+		// a char mode terminal sends C-z to its process instead
+		t := g.terminal_of(g.active.leaf.buf)
+		if g.overlay != nil || t == nil || !t.takes_keys() {
+			suspend(g)
+		}
 	}
 }
 
-func (g *godit) on_alt_key(ev *termbox.Event) bool {
-	switch ev.Ch {
-	case 'g':
-		g.set_overlay_mode(init_line_edit_mode(g, g.goto_line_lemp()))
-		return true
-	case '/':
-		g.set_overlay_mode(init_autocomplete_mode(g))
-		return true
-	case 'q':
-		g.set_overlay_mode(init_fill_region_mode(g))
-		return true
+func (g *godit) on_key(ev *termbox.Event) {
+	v := g.active.leaf
+	if v.buf.on_key != nil && v.buf.on_key(v, ev) {
+		return
 	}
-	return false
+	if ev.Mod&termbox.ModAlt != 0 && ev.Ch >= '0' && ev.Ch <= '9' {
+		g.set_overlay_mode(init_universal_argument_mode(g, int(ev.Ch-'0')))
+		return
+	}
+	keys := []key_event{keymap_key(ev)}
+	if c := global_keymap.lookup(keys); c != nil {
+		g.command_keys = keys
+		g.run_command(c)
+		return
+	}
+	if global_keymap.is_prefix(keys) {
+		g.set_overlay_mode(init_prefix_mode(g, keys))
+		return
+	}
+	v.count = g.take_count()
+	v.on_key(ev)
+	v.count = 0
 }
 
-func (g *godit) on_key(ev *termbox.Event) {
-	v := g.active.leaf
-	switch ev.Key {
-	case termbox.KeyCtrlX:
-		g.set_overlay_mode(init_extended_mode(g))
-	case termbox.KeyCtrlS:
-		g.set_overlay_mode(init_isearch_mode(g, false))
-	case termbox.KeyCtrlR:
-		g.set_overlay_mode(init_isearch_mode(g, true))
-	default:
-		if ev.Mod&termbox.ModAlt != 0 && g.on_alt_key(ev) {
-			break
-		}
-		v.on_key(ev)
+// Returns the universal argument (1 if there is none) and resets it.
+func (g *godit) take_count() int {
+	n := g.count
+	g.count = 0
+	if n < 1 {
+		return 1
 	}
+	return n
 }
 
 func (g *godit) main_loop() {
@@ -423,10 +610,26 @@ func (g *godit) main_loop() {
 			g.consume_more_events()
 			g.draw()
 			termbox.Flush()
+		case f := <-g.async:
+			f()
+			g.draw()
+			termbox.Flush()
 		}
 	}
 }
 
+// Schedules 'f' to be executed by the main loop, that's the only way for
+// background goroutines to touch the editor state. Returns false without
+// scheduling, if 'cancel' was closed in the meantime.
+func (g *godit) run_async(f func(), cancel <-chan struct{}) bool {
+	select {
+	case g.async <- f:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
 func (g *godit) consume_more_events() bool {
 	for {
 		select {
@@ -446,9 +649,13 @@ func (g *godit) handle_event(ev *termbox.Event) bool {
 	switch ev.Type {
 	case termbox.EventKey:
 		if g.recording {
+			if g.overlay == nil && g.count == 0 {
+				// a new command starts, C-u and prefix keys included
+				g.keymacros_cmd = len(g.keymacros)
+			}
 			g.keymacros = append(g.keymacros, create_key_event(ev))
 		}
-		g.set_status("") // reset status on every key event
+		g.echo("") // reset status on every key event
 		g.on_sys_key(ev)
 		if g.overlay != nil {
 			g.overlay.on_key(ev)
@@ -456,9 +663,19 @@ func (g *godit) handle_event(ev *termbox.Event) bool {
 			g.on_key(ev)
 		}
 
+		// the universal argument lives as long as the command which
+		// consumes it, that is while there is an overlay mode (C-x ...)
+		if g.overlay == nil {
+			g.count = 0
+		}
+
 		if g.quitflag {
 			return false
 		}
+	case termbox.EventMouse:
+		if g.overlay == nil {
+			g.on_mouse(ev)
+		}
 	case termbox.EventResize:
 		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 		g.resize()
@@ -473,9 +690,44 @@ func (g *godit) handle_event(ev *termbox.Event) bool {
 	// after each event, it's cheap and does what it needs to be done
 	v := g.active.leaf
 	v.buf.loc = v.view_location
+	g.visit_buffer(v.buf)
 	return true
 }
 
+// Marks the buffer as the most recently visited one.
+func (g *godit) visit_buffer(buf *buffer) {
+	if buf.last_visit != g.visits {
+		g.visits++
+		buf.last_visit = g.visits
+	}
+}
+
+// Buffers sorted by the last visit, the most recently visited first, except
+// for the buffer of the active view, which goes last.
+func (g *godit) buffers_by_visit() []*buffer {
+	active := g.active.leaf.buf
+	buffers := make([]*buffer, 0, len(g.buffers))
+	for _, buf := range g.buffers {
+		if buf != active {
+			buffers = append(buffers, buf)
+		}
+	}
+	sort.SliceStable(buffers, func(i, j int) bool {
+		return buffers[i].last_visit > buffers[j].last_visit
+	})
+	return append(buffers, active)
+}
+
+// The most recently visited buffer other than the one of the active view or
+// nil if there is no such buffer.
+func (g *godit) previous_buffer() *buffer {
+	buffers := g.buffers_by_visit()
+	if len(buffers) < 2 {
+		return nil
+	}
+	return buffers[0]
+}
+
 func (g *godit) set_overlay_mode(m overlay_mode) {
 	if g.overlay != nil {
 		g.overlay.exit()
@@ -488,6 +740,12 @@ func (g *godit) save_active_buffer(raw bool) {
 	v := g.active.leaf
 	b := v.buf
 
+	if _, ok := g.kmacro_edits[b]; ok {
+		g.store_kmacro_edit(b)
+		g.set_overlay_mode(nil)
+		return
+	}
+
 	if b.path != "" {
 		if b.synced_with_disk() {
 			g.set_status("(No changes need to be saved)")
@@ -511,13 +769,23 @@ func (g *godit) save_active_buffer(raw bool) {
 
 // "lemp" stands for "line edit mode params"
 func (g *godit) switch_buffer_lemp() line_edit_mode_params {
+	prompt := "Buffer:"
+	prev := g.previous_buffer()
+	if prev != nil {
+		prompt = "Buffer (default " + prev.name + "):"
+	}
 	return line_edit_mode_params{
 		ac_decide:      make_godit_buffer_ac_decide(g),
-		prompt:         "Buffer:",
+		ac_filter:      fuzzy_ac_filter,
+		prompt:         prompt,
 		init_autocompl: true,
 
 		on_apply: func(buf *buffer) {
 			bufname := string(buf.contents())
+			if bufname == "" && prev != nil {
+				g.active.leaf.attach(prev)
+				return
+			}
 			for _, buf := range g.buffers {
 				if buf.name == bufname {
 					g.active.leaf.attach(buf)
@@ -534,6 +802,7 @@ func (g *godit) open_buffer_lemp() line_edit_mode_params {
 	return line_edit_mode_params{
 		ac_decide: filesystem_line_ac_decide,
 		prompt:    "Find file:",
+		history:   "file",
 
 		on_apply: func(buf *buffer) {
 			pattern := string(buf.contents())
@@ -553,6 +822,7 @@ func (g *godit) save_as_buffer_lemp(raw bool) line_edit_mode_params {
 	return line_edit_mode_params{
 		ac_decide:       filesystem_line_ac_decide,
 		prompt:          "File to save in:",
+		history:         "file",
 		initial_content: b.name,
 
 		on_apply: func(linebuf *buffer) {
@@ -568,47 +838,18 @@ func (g *godit) save_as_buffer_lemp(raw bool) line_edit_mode_params {
 				b.path = fullpath
 				v.dirty |= dirty_status
 				g.set_status("Wrote %s", b.path)
+				add_recent_file(fullpath)
 			}
 		},
 	}
 }
 
-// "lemp" stands for "line edit mode params"
-func (g *godit) filter_region_lemp() line_edit_mode_params {
-	v := g.active.leaf
-	return line_edit_mode_params{
-		ac_decide: filesystem_line_ac_decide,
-		prompt:    "Filter region through:",
-		on_apply: func(linebuf *buffer) {
-			v.finalize_action_group()
-			cmdstr := string(linebuf.contents())
-			v.region_to(func(data []byte) []byte {
-				// TODO: not portable
-				cmd := exec.Command("/bin/sh", "-c", cmdstr)
-				in, err := cmd.StdinPipe()
-				if err != nil {
-					return clone_byte_slice(data)
-				}
-
-				in.Write(data)
-				in.Close()
-
-				out, err := cmd.Output()
-				if err != nil {
-					return clone_byte_slice(data)
-				}
-				return out
-			})
-			v.finalize_action_group()
-		},
-	}
-}
-
 // "lemp" stands for "line edit mode params"
 func (g *godit) goto_line_lemp() line_edit_mode_params {
 	v := g.active.leaf
 	return line_edit_mode_params{
-		prompt: "Goto line:",
+		prompt:  "Goto line:",
+		history: "line",
 		on_apply: func(buf *buffer) {
 			numstr := string(buf.contents())
 			num, err := strconv.Atoi(numstr)
@@ -622,15 +863,22 @@ func (g *godit) goto_line_lemp() line_edit_mode_params {
 }
 
 // "lemp" stands for "line edit mode params"
-func (g *godit) search_and_replace_lemp1() line_edit_mode_params {
-	var prompt string
+//
+// Replaces in the region if 'files' is nil, otherwise in the files (see
+// replace_in_files_mode.go).
+func (g *godit) search_and_replace_lemp1(files []string) line_edit_mode_params {
+	prompt := "Replace string"
+	if files != nil {
+		prompt = fmt.Sprintf("Replace string in %d files", len(files))
+	}
 	if len(g.s_and_r_last_word) != 0 {
-		prompt = fmt.Sprintf("Replace string [%s]:", g.s_and_r_last_word)
+		prompt += fmt.Sprintf(" [%s]:", g.s_and_r_last_word)
 	} else {
-		prompt = "Replace string:"
+		prompt += ":"
 	}
 	return line_edit_mode_params{
-		prompt: prompt,
+		prompt:  prompt,
+		history: "replace",
 		on_apply: func(buf *buffer) {
 			var word []byte
 			contents := buf.contents()
@@ -645,13 +893,13 @@ func (g *godit) search_and_replace_lemp1() line_edit_mode_params {
 				g.set_status("Nothing to replace")
 				return
 			}
-			g.set_overlay_mode(init_line_edit_mode(g, g.search_and_replace_lemp2(word)))
+			g.set_overlay_mode(init_line_edit_mode(g, g.search_and_replace_lemp2(word, files)))
 		},
 	}
 }
 
 // "lemp" stands for "line edit mode params"
-func (g *godit) search_and_replace_lemp2(word []byte) line_edit_mode_params {
+func (g *godit) search_and_replace_lemp2(word []byte, files []string) line_edit_mode_params {
 	var prompt string
 	if len(g.s_and_r_last_repl) != 0 {
 		prompt = fmt.Sprintf("Replace string %s with [%s]:", word, g.s_and_r_last_repl)
@@ -660,7 +908,8 @@ func (g *godit) search_and_replace_lemp2(word []byte) line_edit_mode_params {
 	}
 	v := g.active.leaf
 	return line_edit_mode_params{
-		prompt: prompt,
+		prompt:  prompt,
+		history: "replace-with",
 		on_apply: func(buf *buffer) {
 			var repl []byte
 			contents := buf.contents()
@@ -671,36 +920,100 @@ func (g *godit) search_and_replace_lemp2(word []byte) line_edit_mode_params {
 			} else {
 				repl = contents
 			}
+			g.s_and_r_last_word = word
+			g.s_and_r_last_repl = repl
+			if files != nil {
+				m := init_replace_in_files_mode(g, files, word, repl)
+				g.set_overlay_mode(m)
+				m.next()
+				return
+			}
 			v.finalize_action_group()
 			v.last_vcommand = vcommand_none
 			g.active.leaf.search_and_replace(word, repl)
 			v.finalize_action_group()
-			g.s_and_r_last_word = word
-			g.s_and_r_last_repl = repl
 		},
 	}
 }
 
+func (g *godit) start_recording() {
+	g.set_status("Defining keyboard macro...")
+	g.recording = true
+	g.keymacros = g.keymacros[:0]
+	g.kmacro_counter_used = false
+}
+
 func (g *godit) stop_recording() {
 	if !g.recording {
 		g.set_status("Not defining keyboard macro")
 		return
 	}
 
-	// clean up the current key combo: "C-x )"
+	// clean up the keys of the current command (e.g. "C-u 2 C-x e")
 	g.recording = false
-	g.keymacros = g.keymacros[:len(g.keymacros)-2]
+	g.keymacros = g.keymacros[:g.keymacros_cmd]
 	if len(g.keymacros) == 0 {
 		g.set_status("Ignore empty macro")
 	} else {
 		g.set_status("Keyboard macro defined")
 	}
+	if g.kmacro_counter_used {
+		g.kmacro_counter++
+	}
 }
 
-func (g *godit) replay_macro() {
-	for _, keyev := range g.keymacros {
-		ev := keyev.to_termbox_event()
-		g.handle_event(&ev)
+func (g *godit) replay_macro(n int) {
+	g.replay_keys(g.keymacros, n)
+}
+
+// Replays 'keys' 'n' times as if they were typed in. If a macro is being
+// recorded, only the keys that invoked the replay are recorded. Replaying stops
+// on the first error, check 'g.macro_error' afterwards.
+func (g *godit) replay_keys(keys []key_event, n int) {
+	recording := g.recording
+	g.recording = false
+	g.count = 0
+	g.macro_error = false
+	g.replaying++
+	g.with_single_undo_group(func() {
+		for i := 0; i < n && !g.macro_error; i++ {
+			used := g.kmacro_counter_used
+			g.kmacro_counter_used = false
+			for _, keyev := range keys {
+				ev := keyev.to_termbox_event()
+				g.handle_event(&ev)
+				if g.filter.cancel != nil {
+					g.wait_filter_in_macro()
+				}
+				if g.macro_error {
+					break
+				}
+			}
+			if g.kmacro_counter_used {
+				g.kmacro_counter++
+			}
+			g.kmacro_counter_used = used
+		}
+	})
+	g.replaying--
+	g.recording = recording
+}
+
+// Runs 'f' with undo action groups finalization suppressed, as a result all
+// the changes made by 'f' are undone with a single undo command.
+func (g *godit) with_single_undo_group(f func()) {
+	g.active.leaf.finalize_action_group()
+	bufs := make([]*buffer, len(g.buffers))
+	copy(bufs, g.buffers)
+	for _, buf := range bufs {
+		buf.undo_lock++
+	}
+	f()
+	for _, buf := range bufs {
+		buf.undo_lock--
+		if buf.undo_lock == 0 && len(buf.views) > 0 {
+			buf.views[0].finalize_action_group()
+		}
 	}
 }
 
@@ -709,6 +1022,9 @@ func (g *godit) view_context() view_context {
 		set_status: func(f string, args ...interface{}) {
 			g.set_status(f, args...)
 		},
+		set_error: func(f string, args ...interface{}) {
+			g.set_error(f, args...)
+		},
 		kill_buffer: &g.killbuffer,
 		buffers:     &g.buffers,
 	}
@@ -724,17 +1040,34 @@ func (g *godit) has_unsaved_buffers() bool {
 }
 
 func main() {
+	restore := flag.Bool("s", false, "restore the last session and save it on exit")
+	flag.Parse()
+
 	err := termbox.Init()
 	if err != nil {
 		panic(err)
 	}
 	defer termbox.Close()
-	termbox.SetInputMode(termbox.InputAlt)
+	termbox.SetInputMode(termbox.InputAlt | termbox.InputMouse)
 
-	godit := new_godit(os.Args[1:])
+	godit := new_godit(flag.Args())
+	if *restore {
+		godit.session = true
+		if err := godit.restore_session(); err != nil {
+			godit.set_status(err.Error())
+		}
+	}
 	godit.resize()
 	godit.draw()
 	termbox.SetCursor(godit.cursor_position())
 	termbox.Flush()
 	godit.main_loop()
+
+	// there is no way to report an error at this point, the session,
+	// places and history are not critical anyway
+	if godit.session {
+		godit.save_session()
+	}
+	godit.save_places()
+	godit.save_history()
 }
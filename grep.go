@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+//----------------------------------------------------------------------------
+// grep
+//
+// Searches all the files of the project in background, matches are streamed
+// into the *grep* buffer as 'file:line: text' entries. RET on an entry (or
+// C-x ` for the next one) visits the location.
+//----------------------------------------------------------------------------
+
+const (
+	grep_buffer_name  = "*grep*"
+	grep_binary_check = 8000 // bytes checked for NUL to detect binary files
+)
+
+type grep_state struct {
+	buf     *buffer // the *grep* buffer of the last search
+	root    string
+	pattern string
+	regexp  bool
+	cancel  chan struct{} // nil if there is no search in progress
+	matches int
+	current int // line of the last visited entry in the *grep* buffer
+}
+
+// Returns a matcher for the pattern, which is either a literal string or a
+// regular expression.
+func make_grep_matcher(pattern string, is_regexp bool) (func([]byte) bool, error) {
+	if !is_regexp {
+		p := []byte(pattern)
+		return func(line []byte) bool {
+			return bytes.Contains(line, p)
+		}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.Match, nil
+}
+
+// Greps a single file, returns formatted entries (nil for binary files).
+func grep_file(root, file string, match func([]byte) bool) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(root, file))
+	if err != nil {
+		return nil
+	}
+	head := data
+	if len(head) > grep_binary_check {
+		head = head[:grep_binary_check]
+	}
+	if bytes.IndexByte(head, 0) != -1 {
+		return nil
+	}
+
+	var out []byte
+	line_num := 1
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if match(line) {
+			out = append(out, file...)
+			out = append(out, ':')
+			out = strconv.AppendInt(out, int64(line_num), 10)
+			out = append(out, ": "...)
+			out = append(out, bytes.TrimRight(line, "\r")...)
+			out = append(out, '\n')
+		}
+		line_num++
+	}
+	return out
+}
+
+// Parses a 'file:line: text' entry.
+func parse_grep_entry(line []byte) (file string, line_num int, ok bool) {
+	i := bytes.Index(line, []byte(": "))
+	for i != -1 {
+		j := bytes.LastIndexByte(line[:i], ':')
+		if j > 0 {
+			n, err := strconv.Atoi(string(line[j+1 : i]))
+			if err == nil && n > 0 {
+				return string(line[:j]), n, true
+			}
+		}
+		k := bytes.Index(line[i+2:], []byte(": "))
+		if k == -1 {
+			break
+		}
+		i += 2 + k
+	}
+	return "", 0, false
+}
+
+func (g *godit) start_grep(pattern string, is_regexp bool) {
+	match, err := make_grep_matcher(pattern, is_regexp)
+	if err != nil {
+		g.set_error(err.Error())
+		return
+	}
+	g.stop_grep()
+
+	gs := &g.grep
+	gs.root = g.project_root()
+	gs.pattern = pattern
+	gs.regexp = is_regexp
+	gs.matches = 0
+	gs.current = 0
+	cancel := make(chan struct{})
+	gs.cancel = cancel
+
+	buf := g.special_buffer(grep_buffer_name)
+	buf.on_key = g.grep_on_key
+	gs.buf = buf
+	what := "string"
+	if is_regexp {
+		what = "regexp"
+	}
+	g.set_special_buffer_contents(buf, []byte(fmt.Sprintf(
+		"Grep for %s %q in %s\n\n", what, pattern, abbreviate_home(gs.root))))
+	g.active.leaf.attach(buf)
+
+	root := gs.root
+	go walk_project(root, cancel, func(files []string, done bool) {
+		for _, file := range files {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			out := grep_file(root, file, match)
+			if out == nil {
+				continue
+			}
+			n := bytes.Count(out, []byte{'\n'})
+			g.run_async(func() {
+				if g.grep.cancel != cancel {
+					return
+				}
+				g.grep.matches += n
+				if g.is_buffer_alive(buf) {
+					g.append_to_special_buffer(buf, out)
+				}
+			}, cancel)
+		}
+		if done {
+			g.run_async(func() {
+				if g.grep.cancel != cancel {
+					return
+				}
+				g.finish_grep("Grep finished")
+			}, cancel)
+		}
+	})
+}
+
+func (g *godit) finish_grep(msg string) {
+	gs := &g.grep
+	if gs.cancel == nil {
+		return
+	}
+	gs.cancel = nil
+	msg = fmt.Sprintf("%s with %d matches", msg, gs.matches)
+	if g.is_buffer_alive(gs.buf) {
+		g.append_to_special_buffer(gs.buf, []byte("\n"+msg+"\n"))
+	}
+	g.set_status(msg)
+}
+
+// Cancels the search in progress, if there is one.
+func (g *godit) stop_grep() {
+	if c := g.grep.cancel; c != nil {
+		close(c)
+		g.finish_grep("Grep cancelled")
+	}
+}
+
+// Visits the location of the *grep* buffer entry at the line 'n'.
+func (g *godit) visit_grep_entry(buf *buffer, n int) bool {
+	line, line_num := buf.line_at(n)
+	if line_num != n {
+		return false
+	}
+	file, file_line, ok := parse_grep_entry(line.data)
+	if !ok {
+		return false
+	}
+	g.grep.current = n
+
+	target, err := g.new_buffer_from_file(filepath.Join(g.grep.root, file))
+	if err != nil {
+		return true
+	}
+	v := g.active.leaf
+	v.attach(target)
+	v.move_cursor_to_line(file_line)
+	return true
+}
+
+func (g *godit) grep_on_key(v *view, ev *termbox.Event) bool {
+	if ev.Mod != 0 || (ev.Key != termbox.KeyEnter && ev.Key != termbox.KeyCtrlJ) {
+		return false
+	}
+	if !g.visit_grep_entry(v.buf, v.cursor.line_num) {
+		g.set_status("(No location on this line)")
+	}
+	return true
+}
+
+// Visits the next entry of the *grep* buffer.
+func (g *godit) next_grep_entry() {
+	var buf *buffer
+	for _, b := range g.buffers {
+		if b.name == grep_buffer_name {
+			buf = b
+		}
+	}
+	if buf == nil {
+		g.set_error("(No grep results)")
+		return
+	}
+
+	for n := g.grep.current + 1; n <= buf.lines_n; n++ {
+		if g.visit_grep_entry(buf, n) {
+			// keep the views of the *grep* buffer in sync
+			for _, v := range buf.views {
+				v.move_cursor_to_line(n)
+			}
+			return
+		}
+	}
+	g.set_error("(No more grep matches)")
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) grep_lemp(is_regexp bool) line_edit_mode_params {
+	prompt := "Grep:"
+	if is_regexp {
+		prompt = "Grep regexp:"
+	}
+	return line_edit_mode_params{
+		ac_decide:       nil,
+		prompt:          prompt,
+		initial_content: g.grep.pattern,
+		history:         "grep",
+
+		on_apply: func(buf *buffer) {
+			pattern := string(buf.contents())
+			if pattern == "" {
+				g.set_status("(Nothing to search for)")
+				return
+			}
+			g.start_grep(pattern, is_regexp)
+		},
+	}
+}
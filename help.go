@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"github.com/nsf/tulib"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//----------------------------------------------------------------------------
+// help
+//
+// Everything here is generated from the live keymaps, so it reflects the
+// bindings from the keys file as well.
+//----------------------------------------------------------------------------
+
+const help_buffer_name = "*help*"
+
+// Describes what the key sequence does, the sequence may be incomplete.
+func describe_keys(keys []key_event) (desc string, complete bool) {
+	seq := key_events_to_string(keys)
+	if c := global_keymap.lookup(keys); c != nil {
+		return fmt.Sprintf("%s runs the command %s: %s", seq, c.name, c.desc), true
+	}
+	if global_keymap.is_prefix(keys) {
+		return seq, false
+	}
+	if len(keys) == 1 {
+		k := keys[0]
+		if c := view_keymap.lookup(keys); c != nil {
+			return fmt.Sprintf("%s runs the command %s: %s", seq, c.name, c.desc), true
+		}
+		if k.mod&termbox.ModAlt != 0 && k.ch >= '0' && k.ch <= '9' {
+			return seq + " is the universal argument (a number)", true
+		}
+		if k.mod == 0 && (k.ch != 0 || k.key == termbox.KeySpace) {
+			return seq + " inserts itself", true
+		}
+	}
+	return seq + " is undefined", true
+}
+
+//----------------------------------------------------------------------------
+// describe key mode
+//----------------------------------------------------------------------------
+
+type describe_key_mode struct {
+	stub_overlay_mode
+	godit *godit
+	keys  []key_event
+}
+
+func init_describe_key_mode(godit *godit) *describe_key_mode {
+	d := &describe_key_mode{godit: godit}
+	godit.echo("Describe key:")
+	return d
+}
+
+func (d *describe_key_mode) on_key(ev *termbox.Event) {
+	g := d.godit
+	d.keys = append(d.keys, keymap_key(ev))
+	desc, complete := describe_keys(d.keys)
+	if !complete {
+		g.echo("Describe key: %s", desc)
+		return
+	}
+	g.set_overlay_mode(nil)
+	g.set_status("%s", desc)
+}
+
+//----------------------------------------------------------------------------
+// bindings list
+//----------------------------------------------------------------------------
+
+func write_bindings(w *bytes.Buffer, km *keymap) {
+	seqs := make([]string, 0, len(km.bindings))
+	for seq := range km.bindings {
+		seqs = append(seqs, seq)
+	}
+	sort.Strings(seqs)
+	for _, seq := range seqs {
+		c := commands[km.bindings[seq]]
+		fmt.Fprintf(w, "  %-16s %-26s %s\n", seq, c.name, c.desc)
+	}
+}
+
+func (g *godit) describe_bindings() {
+	var w bytes.Buffer
+	w.WriteString("Global keys:\n\n")
+	write_bindings(&w, global_keymap)
+	w.WriteString("\nKeys of all the views (including prompts):\n\n")
+	write_bindings(&w, view_keymap)
+
+	var unbound []string
+	for name := range commands {
+		if command_keys(name) == "" {
+			unbound = append(unbound, name)
+		}
+	}
+	if len(unbound) > 0 {
+		sort.Strings(unbound)
+		w.WriteString("\nCommands without keys (use M-x):\n\n")
+		for _, name := range unbound {
+			fmt.Fprintf(&w, "  %-43s %s\n", name, commands[name].desc)
+		}
+	}
+	w.WriteString("\nAfter C-x C-w the views are selected by typing their names.\n")
+
+	buf := g.special_buffer(help_buffer_name)
+	g.set_special_buffer_contents(buf, w.Bytes())
+	g.active.leaf.attach(buf)
+}
+
+//----------------------------------------------------------------------------
+// prefix keys popup
+//----------------------------------------------------------------------------
+
+type key_help struct {
+	key  string
+	name string // command name or "+prefix"
+}
+
+// Returns the keys which may follow the prefix, sorted.
+func prefix_continuations(km *keymap, prefix []key_event) []key_help {
+	ps := key_events_to_string(prefix) + " "
+	next := make(map[string]string)
+	for seq, name := range km.bindings {
+		if !strings.HasPrefix(seq, ps) {
+			continue
+		}
+		rest := strings.Fields(seq[len(ps):])
+		if len(rest) == 1 {
+			// exact bindings take precedence, see 'prefix_mode'
+			next[rest[0]] = name
+		} else if _, ok := next[rest[0]]; !ok {
+			next[rest[0]] = "+prefix"
+		}
+	}
+
+	keys := make([]key_help, 0, len(next))
+	for key, name := range next {
+		keys = append(keys, key_help{key, name})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].key < keys[j].key
+	})
+	return keys
+}
+
+// Draws the keys which may follow the prefix in columns above the status
+// line.
+func draw_prefix_keys(ui *tulib.Buffer, prefix []key_event) {
+	keys := prefix_continuations(global_keymap, prefix)
+	if len(keys) == 0 || ui.Height < 2 {
+		return
+	}
+
+	w := 0
+	for _, k := range keys {
+		if n := utf8.RuneCountInString(k.key) + utf8.RuneCountInString(k.name) + 4; n > w {
+			w = n
+		}
+	}
+	cols := ui.Width / w
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(keys) + cols - 1) / cols
+	if rows > ui.Height-1 {
+		rows = ui.Height - 1
+	}
+
+	lp := default_label_params
+	lp.Fg = termbox.ColorBlack
+	lp.Bg = termbox.ColorWhite
+	r := tulib.Rect{0, ui.Height - 1 - rows, ui.Width, rows}
+	ui.Fill(r, termbox.Cell{Fg: lp.Fg, Bg: lp.Bg, Ch: ' '})
+	for i, k := range keys {
+		col, row := i/rows, i%rows
+		if col >= cols {
+			break
+		}
+		cell := tulib.Rect{col * w, r.Y + row, w, 1}
+		ui.DrawLabel(cell, &lp, []byte(k.key+"  "+k.name))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// minibuffer history
+//
+// Inputs of line edit mode prompts, a separate list for each kind of prompt
+// (see 'line_edit_mode_params.history'). The most recent entry is the last
+// one. The history is saved on exit.
+//----------------------------------------------------------------------------
+
+const (
+	history_file = "history"
+	history_max  = 100 // per kind
+)
+
+type history_entry struct {
+	kind  string
+	entry string
+}
+
+// The file format is line based, one entry per line, oldest first:
+//
+//	<kind> <entry>
+func load_history() (map[string][]string, error) {
+	history := make(map[string][]string)
+	f, err := os.Open(config_path(history_file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		return history, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+		add_history_entry(history, parts[0], parts[1])
+	}
+	return history, s.Err()
+}
+
+// Appends the entry, removing its older duplicate.
+func add_history_entry(history map[string][]string, kind, entry string) {
+	entries := history[kind]
+	for i, e := range entries {
+		if e == entry {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	entries = append(entries, entry)
+	if len(entries) > history_max {
+		entries = entries[len(entries)-history_max:]
+	}
+	history[kind] = entries
+}
+
+func (g *godit) add_history(kind, entry string) {
+	if kind == "" || entry == "" || strings.Contains(entry, "\n") {
+		return
+	}
+	add_history_entry(g.history, kind, entry)
+	g.history_added = append(g.history_added, history_entry{kind, entry})
+}
+
+// The entries added since the start are merged into the file, since there can
+// be a few godit instances running at the same time.
+func (g *godit) save_history() error {
+	history, err := load_history()
+	if err != nil {
+		return err
+	}
+	for _, he := range g.history_added {
+		add_history_entry(history, he.kind, he.entry)
+	}
+
+	f, err := create_config_file(history_file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for kind, entries := range history {
+		for _, e := range entries {
+			w.WriteString(kind + " " + e + "\n")
+		}
+	}
+	return w.Flush()
+}
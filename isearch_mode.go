@@ -89,6 +89,7 @@ func (m *isearch_mode) search(next bool) {
 		m.set_prompt(m.prompt_failing)
 		m.failing = true
 		m.wrapped = false
+		m.godit.set_error("Search failed: %s", m.last_word)
 	} else {
 		m.last_loc = cursor
 		v.set_tags(view_tag{
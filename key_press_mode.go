@@ -18,7 +18,7 @@ func init_key_press_mode(godit *godit, actions map[rune]func(), def rune, prompt
 	k.actions = actions
 	k.def = def
 	k.prompt = prompt
-	k.godit.set_status(prompt)
+	k.godit.echo(prompt)
 	return k
 }
 
@@ -37,6 +37,6 @@ func (k *key_press_mode) on_key(ev *termbox.Event) {
 		action()
 		k.godit.set_overlay_mode(nil)
 	} else {
-		k.godit.set_status(k.prompt)
+		k.godit.echo(k.prompt)
 	}
 }
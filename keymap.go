@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"os"
+	"sort"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// keymaps
+//
+// A keymap maps key sequences (e.g. "C-x C-f") to command names, proper
+// prefixes of the bound sequences are prefix keys (see 'prefix_mode'). The
+// view keymap has single keys only, it is used by all the views including the
+// line edit mode ones.
+//
+// Default bindings can be overridden in ~/.config/godit/keys.
+//----------------------------------------------------------------------------
+
+type keymap struct {
+	bindings map[string]string // key sequence -> command name
+	prefixes map[string]int    // prefix -> number of sequences starting with it
+}
+
+func new_keymap() *keymap {
+	return &keymap{
+		bindings: make(map[string]string),
+		prefixes: make(map[string]int),
+	}
+}
+
+var (
+	global_keymap = new_keymap() // see 'godit.on_key'
+	view_keymap   = new_keymap() // see 'view.on_key'
+)
+
+// Normalizes the key event to be used in a key sequence.
+func keymap_key(ev *termbox.Event) key_event {
+	k := key_event{mod: ev.Mod & termbox.ModAlt}
+	if ev.Ch != 0 {
+		k.ch = ev.Ch
+	} else {
+		k.key = ev.Key
+	}
+	return k
+}
+
+func (km *keymap) set(keys []key_event, name string) {
+	seq := key_events_to_string(keys)
+	if _, ok := km.bindings[seq]; !ok {
+		for i := 1; i < len(keys); i++ {
+			km.prefixes[key_events_to_string(keys[:i])]++
+		}
+	}
+	km.bindings[seq] = name
+}
+
+func (km *keymap) unset(keys []key_event) {
+	seq := key_events_to_string(keys)
+	if _, ok := km.bindings[seq]; !ok {
+		return
+	}
+	delete(km.bindings, seq)
+	for i := 1; i < len(keys); i++ {
+		prefix := key_events_to_string(keys[:i])
+		if km.prefixes[prefix]--; km.prefixes[prefix] <= 0 {
+			delete(km.prefixes, prefix)
+		}
+	}
+}
+
+// Removes all the sequences starting with the prefix.
+func (km *keymap) unset_prefix(prefix []key_event) {
+	ps := key_events_to_string(prefix) + " "
+	for seq := range km.bindings {
+		if !strings.HasPrefix(seq, ps) {
+			continue
+		}
+		if keys, err := parse_key_events(seq); err == nil {
+			km.unset(keys)
+		}
+	}
+}
+
+// Binds the command to the key sequences, used for the default bindings, the
+// key names must be valid.
+func (km *keymap) bind(name string, seqs ...string) {
+	for _, seq := range seqs {
+		keys, err := parse_key_events(seq)
+		if err != nil {
+			panic(err)
+		}
+		km.set(keys, name)
+	}
+}
+
+func (km *keymap) lookup(keys []key_event) *command {
+	name, ok := km.bindings[key_events_to_string(keys)]
+	if !ok {
+		return nil
+	}
+	return commands[name]
+}
+
+func (km *keymap) is_prefix(keys []key_event) bool {
+	return km.prefixes[key_events_to_string(keys)] > 0
+}
+
+// Returns the key sequences the command is bound to, sorted.
+func (km *keymap) keys_of(name string) []string {
+	var seqs []string
+	for seq, n := range km.bindings {
+		if n == name {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Strings(seqs)
+	return seqs
+}
+
+// Single key view commands go to the view keymap, everything else goes to the
+// global one. The "undefined" command removes the binding.
+func bind_key(keys []key_event, name string) error {
+	if name == "undefined" {
+		global_keymap.unset(keys)
+		view_keymap.unset(keys)
+		return nil
+	}
+	c, ok := commands[name]
+	if !ok {
+		return errors.New("unknown command: " + name)
+	}
+	if c.view != nil && len(keys) == 1 {
+		// make sure the global keymap doesn't shadow it
+		global_keymap.unset(keys)
+		global_keymap.unset_prefix(keys)
+		view_keymap.set(keys, name)
+		return nil
+	}
+	global_keymap.set(keys, name)
+	return nil
+}
+
+//----------------------------------------------------------------------------
+// keys file
+//----------------------------------------------------------------------------
+
+const keys_file = "keys"
+
+// The file format is line based, one binding per line:
+//
+//	<key sequence> <command>
+//
+// e.g. "C-c g grep". Empty lines and lines starting with '#' are ignored.
+// Returns the first error, the rest of the file is loaded anyway.
+func load_keys() error {
+	f, err := os.Open(config_path(keys_file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var errs []error
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			errs = append(errs, fmt.Errorf("%s:%d: syntax error", keys_file, n))
+			continue
+		}
+		last := len(fields) - 1
+		keys, err := parse_key_events(strings.Join(fields[:last], " "))
+		if err == nil {
+			err = bind_key(keys, fields[last])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %s", keys_file, n, err))
+		}
+	}
+	if err := s.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("%s (and %d more errors)", errs[0], len(errs)-1)
+}
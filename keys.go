@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"strings"
+	"unicode/utf8"
+)
+
+//----------------------------------------------------------------------------
+// key names
+//
+// Readable representation of key presses, e.g. "C-x", "M-f", "<f1>", "RET".
+// The notation is close to what tulib.KeyToString gives, but it is guaranteed
+// to survive the round trip: parse_key_events(key_events_to_string(keys))
+// gives back the original 'keys'.
+//----------------------------------------------------------------------------
+
+var key_names = map[termbox.Key]string{
+	termbox.KeyF1:             "<f1>",
+	termbox.KeyF2:             "<f2>",
+	termbox.KeyF3:             "<f3>",
+	termbox.KeyF4:             "<f4>",
+	termbox.KeyF5:             "<f5>",
+	termbox.KeyF6:             "<f6>",
+	termbox.KeyF7:             "<f7>",
+	termbox.KeyF8:             "<f8>",
+	termbox.KeyF9:             "<f9>",
+	termbox.KeyF10:            "<f10>",
+	termbox.KeyF11:            "<f11>",
+	termbox.KeyF12:            "<f12>",
+	termbox.KeyInsert:         "<insert>",
+	termbox.KeyDelete:         "<delete>",
+	termbox.KeyHome:           "<home>",
+	termbox.KeyEnd:            "<end>",
+	termbox.KeyPgup:           "<pgup>",
+	termbox.KeyPgdn:           "<pgdn>",
+	termbox.KeyArrowUp:        "<up>",
+	termbox.KeyArrowDown:      "<down>",
+	termbox.KeyArrowLeft:      "<left>",
+	termbox.KeyArrowRight:     "<right>",
+	termbox.KeyCtrlSpace:      "C-SPC",
+	termbox.KeyCtrlA:          "C-a",
+	termbox.KeyCtrlB:          "C-b",
+	termbox.KeyCtrlC:          "C-c",
+	termbox.KeyCtrlD:          "C-d",
+	termbox.KeyCtrlE:          "C-e",
+	termbox.KeyCtrlF:          "C-f",
+	termbox.KeyCtrlG:          "C-g",
+	termbox.KeyCtrlH:          "C-h",
+	termbox.KeyTab:            "TAB",
+	termbox.KeyCtrlJ:          "C-j",
+	termbox.KeyCtrlK:          "C-k",
+	termbox.KeyCtrlL:          "C-l",
+	termbox.KeyEnter:          "RET",
+	termbox.KeyCtrlN:          "C-n",
+	termbox.KeyCtrlO:          "C-o",
+	termbox.KeyCtrlP:          "C-p",
+	termbox.KeyCtrlQ:          "C-q",
+	termbox.KeyCtrlR:          "C-r",
+	termbox.KeyCtrlS:          "C-s",
+	termbox.KeyCtrlT:          "C-t",
+	termbox.KeyCtrlU:          "C-u",
+	termbox.KeyCtrlV:          "C-v",
+	termbox.KeyCtrlW:          "C-w",
+	termbox.KeyCtrlX:          "C-x",
+	termbox.KeyCtrlY:          "C-y",
+	termbox.KeyCtrlZ:          "C-z",
+	termbox.KeyEsc:            "ESC",
+	termbox.KeyCtrlBackslash:  "C-\\",
+	termbox.KeyCtrlRsqBracket: "C-]",
+	termbox.KeyCtrl6:          "C-6",
+	termbox.KeyCtrlSlash:      "C-/",
+	termbox.KeySpace:          "SPC",
+	termbox.KeyBackspace2:     "DEL",
+}
+
+var key_by_name = make_key_by_name()
+
+func make_key_by_name() map[string]termbox.Key {
+	m := make(map[string]termbox.Key, len(key_names))
+	for key, name := range key_names {
+		m[name] = key
+	}
+	return m
+}
+
+func (k key_event) String() string {
+	var buf bytes.Buffer
+	if k.mod&termbox.ModAlt != 0 {
+		buf.WriteString("M-")
+	}
+	if k.ch != 0 {
+		buf.WriteRune(k.ch)
+	} else if name, ok := key_names[k.key]; ok {
+		buf.WriteString(name)
+	} else {
+		fmt.Fprintf(&buf, "<key-%d>", k.key)
+	}
+	return buf.String()
+}
+
+func key_events_to_string(keys []key_event) string {
+	strs := make([]string, len(keys))
+	for i, k := range keys {
+		strs[i] = k.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+func parse_key_event(s string) (key_event, error) {
+	var k key_event
+	if len(s) > 2 && strings.HasPrefix(s, "M-") {
+		k.mod = termbox.ModAlt
+		s = s[2:]
+	}
+
+	if utf8.RuneCountInString(s) == 1 {
+		k.ch, _ = utf8.DecodeRuneInString(s)
+		return k, nil
+	}
+	if key, ok := key_by_name[s]; ok {
+		k.key = key
+		return k, nil
+	}
+	var n int
+	if _, err := fmt.Sscanf(s, "<key-%d>", &n); err == nil {
+		k.key = termbox.Key(n)
+		return k, nil
+	}
+	return k, errors.New("unknown key: " + s)
+}
+
+// Parses a whitespace separated sequence of keys, e.g. "C-x C-f".
+func parse_key_events(s string) ([]key_event, error) {
+	fields := strings.Fields(s)
+	keys := make([]key_event, 0, len(fields))
+	for _, f := range fields {
+		k, err := parse_key_event(f)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
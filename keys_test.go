@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+import "github.com/nsf/termbox-go"
+
+func TestKeyEventsRoundTrip(t *testing.T) {
+	keys := []key_event{
+		{key: termbox.KeyCtrlX},
+		{key: termbox.KeyCtrlF},
+		{ch: 'a'},
+		{ch: 'M'},
+		{ch: '-'},
+		{mod: termbox.ModAlt, ch: 'f'},
+		{mod: termbox.ModAlt, key: termbox.KeyBackspace2},
+		{key: termbox.KeySpace},
+		{key: termbox.KeyEnter},
+		{key: termbox.KeyTab},
+		{key: termbox.KeyArrowUp},
+		{key: termbox.KeyCtrlSlash},
+		{ch: 'ж'},
+	}
+	s := key_events_to_string(keys)
+	parsed, err := parse_key_events(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(keys) {
+		t.Fatalf("%q: expected %d keys, got %d", s, len(keys), len(parsed))
+	}
+	for i := range keys {
+		if parsed[i] != keys[i] {
+			t.Errorf("%q: key %d: expected %v, got %v", s, i, keys[i], parsed[i])
+		}
+	}
+}
+
+func TestParseKeyEventsError(t *testing.T) {
+	if _, err := parse_key_events("C-x C-what"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
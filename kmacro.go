@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// named keyboard macros
+//
+// The last recorded macro (godit.keymacros) can be given a name, named macros
+// can be bound to 'C-x C-k <key>', edited as text and saved to a file, where
+// each of them is stored as a readable key sequence. The file is loaded at
+// startup. A macro is edited in a buffer, one key per line, C-x C-s in that
+// buffer stores the macro.
+//----------------------------------------------------------------------------
+
+const kmacros_file = "macros"
+
+// Only digits and upper case letters can be used for bindings, other keys
+// in the 'C-x C-k' map are reserved for macro commands.
+func is_kmacro_binding_key(ch rune) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'A' && ch <= 'Z')
+}
+
+// Binds 'C-x C-k <ch>' to the macro, see 'call_bound_kmacro'.
+func (g *godit) bind_kmacro_key(ch rune, name string) {
+	g.kmacro_bindings[ch] = name
+	global_keymap.bind("call-bound-kbd-macro", "C-x C-k "+string(ch))
+}
+
+// Executes the macro bound to the last key of the command key sequence.
+func (g *godit) call_bound_kmacro() {
+	if len(g.command_keys) == 0 {
+		g.set_error("(Keyboard macro must be called with C-x C-k <key>)")
+		return
+	}
+	ch := g.command_keys[len(g.command_keys)-1].ch
+	name, ok := g.kmacro_bindings[ch]
+	if !ok {
+		g.set_error("(No keyboard macro bound to C-x C-k %c)", ch)
+		return
+	}
+	g.execute_kmacro(name, g.take_count())
+}
+
+func is_valid_kmacro_name(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t")
+}
+
+func (g *godit) kmacro_names() []string {
+	names := make([]string, 0, len(g.kmacros))
+	for name := range g.kmacros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *godit) execute_kmacro(name string, n int) {
+	keys, ok := g.kmacros[name]
+	if !ok {
+		g.set_status("(Keyboard macro %s doesn't exist)", name)
+		return
+	}
+	g.replay_keys(keys, n)
+}
+
+// Runs the last keyboard macro once for each line in the region, every run
+// starts at the beginning of the line. The macro may insert or delete lines,
+// the next line is found by taking that into account. Stops on the first
+// error or if there are no more lines in the buffer. All the changes are
+// undone with a single undo command.
+func (g *godit) apply_macro_to_region_lines() {
+	v := g.active.leaf
+	if !v.buf.is_mark_set() {
+		g.set_error("The mark is not set now, so there is no region")
+		return
+	}
+	if len(g.keymacros) == 0 {
+		g.set_error("(No keyboard macro defined)")
+		return
+	}
+
+	beg, end := v.region()
+	n := end.line_num - beg.line_num + 1
+	if end.bol() && n > 1 {
+		// the region ends at the beginning of a line, which means the
+		// line is not a part of it
+		n--
+	}
+
+	line_num := beg.line_num
+	applied := 0
+	g.with_single_undo_group(func() {
+		for applied < n {
+			v.move_cursor_to_line(line_num)
+			lines_n := v.buf.lines_n
+			g.replay_keys(g.keymacros, 1)
+			if g.macro_error || g.active.leaf != v {
+				break
+			}
+			applied++
+			line_num += 1 + v.buf.lines_n - lines_n
+			if line_num > v.buf.lines_n {
+				break
+			}
+		}
+	})
+	if !g.macro_error {
+		g.set_status("Keyboard macro applied to %d line(s)", applied)
+	}
+}
+
+// Inserts the keyboard macro counter at the cursor. The counter is incremented
+// once per macro execution (or recording) in which it was inserted, that way
+// all the insertions within one run give the same number. Outside of macros
+// it's incremented right away.
+func (g *godit) insert_kmacro_counter() {
+	v := g.active.leaf
+	if v.check_read_only() {
+		return
+	}
+	data := []byte(fmt.Sprintf(g.kmacro_counter_format, g.kmacro_counter))
+	c := v.cursor
+	v.finalize_action_group()
+	v.action_insert(c, data)
+	v.last_vcommand = vcommand_none
+	v.dirty = dirty_everything
+	c.move_n_bytes_forward(data)
+	v.move_cursor_to(c)
+	v.finalize_action_group()
+
+	if g.recording || g.replaying > 0 {
+		g.kmacro_counter_used = true
+	} else {
+		g.kmacro_counter++
+	}
+}
+
+func is_valid_kmacro_counter_format(format string) bool {
+	return !strings.Contains(fmt.Sprintf(format, 0), "%!")
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) set_kmacro_counter_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		prompt:          "Macro counter value:",
+		initial_content: strconv.Itoa(g.kmacro_counter),
+		on_apply: func(buf *buffer) {
+			n, err := strconv.Atoi(string(buf.contents()))
+			if err != nil {
+				g.set_status(err.Error())
+				return
+			}
+			g.kmacro_counter = n
+		},
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) set_kmacro_counter_format_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		prompt:          "Macro counter format:",
+		initial_content: g.kmacro_counter_format,
+		on_apply: func(buf *buffer) {
+			format := string(buf.contents())
+			if !is_valid_kmacro_counter_format(format) {
+				g.set_status("(Invalid format, must contain one integer verb, e.g. %%03d)")
+				return
+			}
+			g.kmacro_counter_format = format
+		},
+	}
+}
+
+func (g *godit) save_kmacros() error {
+	f, err := create_config_file(kmacros_file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# godit keyboard macros")
+	for _, name := range g.kmacro_names() {
+		fmt.Fprintf(w, "macro %s %s\n", name,
+			key_events_to_string(g.kmacros[name]))
+	}
+
+	keys := make([]string, 0, len(g.kmacro_bindings))
+	for ch := range g.kmacro_bindings {
+		keys = append(keys, string(ch))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ch := []rune(key)[0]
+		fmt.Fprintf(w, "bind %c %s\n", ch, g.kmacro_bindings[ch])
+	}
+	return w.Flush()
+}
+
+// The file format is line based, empty lines and lines starting with '#' are
+// ignored, the rest looks like that:
+//
+//	macro <name> <key> <key> ...
+//	bind <key> <name>
+func (g *godit) load_kmacros() error {
+	f, err := os.Open(config_path(kmacros_file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch {
+		case fields[0] == "macro" && len(fields) >= 3:
+			keys, err := parse_key_events(strings.Join(fields[2:], " "))
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", kmacros_file, n, err)
+			}
+			g.kmacros[fields[1]] = keys
+		case fields[0] == "bind" && len(fields) == 3:
+			k, err := parse_key_event(fields[1])
+			if err != nil || k.mod != 0 || !is_kmacro_binding_key(k.ch) {
+				return fmt.Errorf("%s:%d: bad binding key: %s",
+					kmacros_file, n, fields[1])
+			}
+			g.bind_kmacro_key(k.ch, fields[2])
+		default:
+			return fmt.Errorf("%s:%d: syntax error", kmacros_file, n)
+		}
+	}
+	return s.Err()
+}
+
+func make_kmacro_ac_decide(godit *godit) ac_decide_func {
+	return func(*view) ac_func {
+		return func(view *view) ([]ac_proposal, int) {
+			prefix := string(view.buf.contents()[:view.cursor.boffset])
+			proposals := make([]ac_proposal, 0, 20)
+			for _, name := range godit.kmacro_names() {
+				if strings.HasPrefix(name, prefix) {
+					proposals = append(proposals, ac_proposal{
+						display: []byte(name),
+						content: []byte(name),
+					})
+				}
+			}
+			return proposals, view.cursor_coffset
+		}
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) name_kmacro_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		prompt: "Name for last keyboard macro:",
+		on_apply: func(buf *buffer) {
+			name := string(buf.contents())
+			if !is_valid_kmacro_name(name) {
+				g.set_status("(Invalid keyboard macro name)")
+				return
+			}
+			g.kmacros[name] = clone_key_events(g.keymacros)
+			g.set_status("Keyboard macro named %s", name)
+		},
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) execute_kmacro_lemp() line_edit_mode_params {
+	n := g.take_count()
+	return line_edit_mode_params{
+		ac_decide: make_kmacro_ac_decide(g),
+		prompt:    "Execute keyboard macro:",
+		on_apply: func(buf *buffer) {
+			g.execute_kmacro(string(buf.contents()), n)
+		},
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) bind_kmacro_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		ac_decide: make_kmacro_ac_decide(g),
+		prompt:    "Bind keyboard macro (default last):",
+		on_apply: func(buf *buffer) {
+			name := string(buf.contents())
+			if name != "" {
+				if _, ok := g.kmacros[name]; !ok {
+					g.set_status("(Keyboard macro %s doesn't exist)", name)
+					return
+				}
+			} else if len(g.keymacros) == 0 {
+				g.set_status("(No keyboard macro defined)")
+				return
+			}
+
+			actions := make(map[rune]func())
+			bind := func(ch rune) {
+				if name == "" {
+					name = "kmacro-" + string(ch)
+					g.kmacros[name] = clone_key_events(g.keymacros)
+				}
+				g.bind_kmacro_key(ch, name)
+				g.set_status("Keyboard macro %s bound to C-x C-k %c", name, ch)
+			}
+			for ch := '0'; ch <= 'Z'; ch++ {
+				if is_kmacro_binding_key(ch) {
+					ch := ch
+					actions[ch] = func() { bind(ch) }
+				}
+			}
+			g.set_overlay_mode(init_key_press_mode(g, actions, 0,
+				"Bind to key: C-x C-k (0-9, A-Z)"))
+		},
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) edit_kmacro_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		ac_decide: make_kmacro_ac_decide(g),
+		prompt:    "Edit keyboard macro (default last):",
+		on_apply: func(buf *buffer) {
+			name := string(buf.contents())
+			keys := g.keymacros
+			if name != "" {
+				var ok bool
+				keys, ok = g.kmacros[name]
+				if !ok {
+					g.set_status("(Keyboard macro %s doesn't exist)", name)
+					return
+				}
+			}
+			g.edit_kmacro(name, keys)
+		},
+	}
+}
+
+// Opens the macro in a buffer, an empty name means the last macro.
+func (g *godit) edit_kmacro(name string, keys []key_event) {
+	for buf, n := range g.kmacro_edits {
+		if n == name {
+			g.active.leaf.attach(buf)
+			return
+		}
+	}
+
+	var data bytes.Buffer
+	for _, k := range keys {
+		data.WriteString(k.String() + "\n")
+	}
+	buf, err := new_buffer(&data)
+	if err != nil {
+		g.set_status(err.Error())
+		return
+	}
+	title := name
+	if title == "" {
+		title = "last"
+	}
+	buf.name = g.buffer_name("*kmacro " + title + "*")
+	g.buffers = append(g.buffers, buf)
+	g.kmacro_edits[buf] = name
+	g.active.leaf.attach(buf)
+	g.set_status("One key per line, C-x C-s stores the macro")
+}
+
+// Stores the macro edited in the buffer (see 'edit_kmacro').
+func (g *godit) store_kmacro_edit(buf *buffer) {
+	var keys []key_event
+	for l, n := buf.first_line, 1; l != nil; l, n = l.next, n+1 {
+		line := strings.TrimSpace(string(l.data))
+		if line == "" {
+			continue
+		}
+		k, err := parse_key_events(line)
+		if err != nil {
+			g.set_status("Line %d: %s", n, err)
+			return
+		}
+		keys = append(keys, k...)
+	}
+
+	name := g.kmacro_edits[buf]
+	if name == "" {
+		g.keymacros = keys
+	} else {
+		g.kmacros[name] = keys
+	}
+	buf.on_disk = buf.history
+	g.set_status("Keyboard macro updated")
+}
+
+func clone_key_events(keys []key_event) []key_event {
+	c := make([]key_event, len(keys))
+	copy(c, keys)
+	return c
+}
@@ -19,15 +19,26 @@ type line_edit_mode struct {
 	lineview *view
 	prompt   []byte
 	prompt_w int
+
+	// history browsing (M-p/M-n) and incremental search (C-r)
+	hist_pos     int    // entry being shown counting from the newest, -1 if none
+	hist_saved   string // the edited line, restored by M-n
+	hsearch      []byte // history search string, nil if not searching
+	hsearch_fail bool
 }
 
 type line_edit_mode_params struct {
 	on_apply        func(buffer *buffer)
 	on_cancel       func()
 	ac_decide       ac_decide_func
+	ac_filter       ac_filter_func
 	prompt          string
 	initial_content string
 	init_autocompl  bool
+
+	// history kind, prompts of the same kind share the input history (see
+	// history.go), no history if empty
+	history string
 }
 
 func (l *line_edit_mode) exit() {
@@ -37,6 +48,10 @@ func (l *line_edit_mode) exit() {
 }
 
 func (l *line_edit_mode) on_key(ev *termbox.Event) {
+	if l.history != "" && l.on_history_key(ev) {
+		return
+	}
+
 	switch ev.Key {
 	case termbox.KeyEnter, termbox.KeyCtrlJ:
 		if l.lineview.ac != nil {
@@ -49,6 +64,7 @@ func (l *line_edit_mode) on_key(ev *termbox.Event) {
 		// reset overlay mode earlier so that 'on_apply' can
 		// override it
 		l.godit.set_overlay_mode(nil)
+		l.godit.add_history(l.history, string(l.linebuf.contents()))
 		if l.on_apply != nil {
 			l.on_apply(l.linebuf)
 		}
@@ -59,6 +75,103 @@ func (l *line_edit_mode) on_key(ev *termbox.Event) {
 	}
 }
 
+// Handles history keys, returns false if the key should be handled as usual.
+func (l *line_edit_mode) on_history_key(ev *termbox.Event) bool {
+	if l.hsearch != nil {
+		ch := ev.Ch
+		if ev.Key == termbox.KeySpace {
+			ch = ' '
+		}
+		switch {
+		case ev.Key == termbox.KeyCtrlR:
+			l.history_search(l.hist_pos + 1)
+			return true
+		case ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+			if len(l.hsearch) > 0 {
+				_, rlen := utf8.DecodeLastRune(l.hsearch)
+				l.hsearch = l.hsearch[:len(l.hsearch)-rlen]
+			}
+			l.history_search(l.hist_pos)
+			return true
+		case ev.Mod == 0 && ch != 0:
+			l.hsearch = append(l.hsearch, string(ch)...)
+			l.history_search(l.hist_pos)
+			return true
+		}
+		// any other key finishes the search and does its job
+		l.hsearch = nil
+		l.set_prompt(l.line_edit_mode_params.prompt)
+	}
+
+	switch {
+	case ev.Key == termbox.KeyCtrlR:
+		l.hsearch = []byte{}
+		l.history_search(l.hist_pos)
+	case ev.Mod&termbox.ModAlt != 0 && ev.Ch == 'p':
+		if !l.show_history_entry(l.hist_pos + 1) {
+			l.godit.set_status("(Beginning of history)")
+		}
+	case ev.Mod&termbox.ModAlt != 0 && ev.Ch == 'n':
+		if !l.show_history_entry(l.hist_pos - 1) {
+			l.godit.set_status("(End of history)")
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// Replaces the line contents with the history entry 'n' (counting from the
+// newest one), -1 is the line being edited.
+func (l *line_edit_mode) show_history_entry(n int) bool {
+	entries := l.godit.history[l.history]
+	if n < -1 || n >= len(entries) {
+		return false
+	}
+	if l.hist_pos == -1 {
+		l.hist_saved = string(l.linebuf.contents())
+	}
+	l.hist_pos = n
+	if n == -1 {
+		l.set_line(l.hist_saved)
+	} else {
+		l.set_line(entries[len(entries)-1-n])
+	}
+	return true
+}
+
+// Shows the first entry starting from 'n' which contains the search string.
+func (l *line_edit_mode) history_search(n int) {
+	entries := l.godit.history[l.history]
+	if n < 0 {
+		n = 0
+	}
+	l.hsearch_fail = true
+	for ; n < len(entries); n++ {
+		if strings.Contains(entries[len(entries)-1-n], string(l.hsearch)) {
+			l.show_history_entry(n)
+			l.hsearch_fail = false
+			break
+		}
+	}
+	prompt := "History search [" + string(l.hsearch) + "]:"
+	if l.hsearch_fail {
+		prompt = "Failing history search [" + string(l.hsearch) + "]:"
+	}
+	l.set_prompt(prompt)
+}
+
+func (l *line_edit_mode) set_line(s string) {
+	l.linebuf, _ = new_buffer(strings.NewReader(s))
+	l.lineview.attach(l.linebuf)
+	l.lineview.on_vcommand(vcommand_move_cursor_end_of_line, 0)
+}
+
+func (l *line_edit_mode) set_prompt(prompt string) {
+	l.prompt = []byte(prompt)
+	l.prompt_w = utf8.RuneCount(l.prompt)
+}
+
 func (l *line_edit_mode) resize(ev *termbox.Event) {
 	w, h := ev.Width-l.prompt_w-1, 1
 	if w < 1 || ev.Height < 1 {
@@ -124,8 +237,9 @@ func init_line_edit_mode(godit *godit, p line_edit_mode_params) *line_edit_mode
 	l.lineview = new_view(godit.view_context(), l.linebuf)
 	l.lineview.oneline = true          // enable one line mode
 	l.lineview.ac_decide = p.ac_decide // override ac_decide function
-	l.prompt = []byte(p.prompt)
-	l.prompt_w = utf8.RuneCount(l.prompt)
+	l.lineview.ac_filter = p.ac_filter
+	l.set_prompt(p.prompt)
+	l.hist_pos = -1
 	l.lineview.resize(l.godit.uibuf.Width-l.prompt_w-1, 1)
 	l.lineview.on_vcommand(vcommand_move_cursor_end_of_line, 0)
 	if l.init_autocompl {
@@ -11,9 +11,10 @@ type macro_repeat_mode struct {
 
 func init_macro_repeat_mode(godit *godit) macro_repeat_mode {
 	m := macro_repeat_mode{godit: godit}
+	n := godit.take_count()
 	godit.set_overlay_mode(nil)
-	m.godit.replay_macro()
-	m.godit.set_status("(Type e to repeat macro)")
+	m.godit.replay_macro(n)
+	m.godit.echo("(Type e to repeat macro)")
 	return m
 }
 
@@ -21,9 +22,9 @@ func (m macro_repeat_mode) on_key(ev *termbox.Event) {
 	g := m.godit
 	if ev.Mod == 0 && ev.Ch == 'e' {
 		g.set_overlay_mode(nil)
-		g.replay_macro()
+		g.replay_macro(1)
 		g.set_overlay_mode(m)
-		g.set_status("(Type e to repeat macro)")
+		g.echo("(Type e to repeat macro)")
 		return
 	}
 
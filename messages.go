@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+//----------------------------------------------------------------------------
+// messages
+//
+// Every status message is recorded with a timestamp in the *Messages*
+// buffer, so that it can be read after the status line was reset. Prompts
+// and key echoes use 'godit.echo' and are not recorded.
+//----------------------------------------------------------------------------
+
+const (
+	messages_buffer_name = "*Messages*"
+	messages_max_lines   = 1000
+)
+
+type messages_state struct {
+	last  string // consecutive duplicates are recorded once
+	early []byte // messages logged before the views were created
+}
+
+func (g *godit) log_message(msg string) {
+	if msg == "" || msg == g.messages.last {
+		return
+	}
+	g.messages.last = msg
+	entry := fmt.Sprintf("%s %s\n", time.Now().Format("15:04:05"), msg)
+	if g.views == nil {
+		// the first buffer is the one shown initially, don't take its
+		// place
+		g.messages.early = append(g.messages.early, entry...)
+		return
+	}
+
+	buf := g.special_buffer(messages_buffer_name)
+	data := append(g.messages.early, entry...)
+	g.messages.early = nil
+	g.append_to_special_buffer(buf, data)
+	if n := buf.lines_n - messages_max_lines; n > 0 {
+		g.modify_special_buffer(buf, func(v *view) {
+			beg := cursor_location{buf.first_line, 1, 0}
+			line, line_num := buf.line_at(n + 1)
+			end := cursor_location{line, line_num, 0}
+			v.action_delete(beg, beg.distance(end))
+		})
+	}
+}
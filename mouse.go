@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+//----------------------------------------------------------------------------
+// mouse support
+//
+// Left click activates a view and moves the cursor, dragging selects a region
+// (the mark is set where the drag has started), dragging a splitter resizes
+// views, the wheel scrolls the view under the pointer. Mouse events are
+// ignored while there is an overlay mode.
+//----------------------------------------------------------------------------
+
+const mouse_wheel_lines = 3
+
+type mouse_drag struct {
+	split  *view_tree // splitter being dragged
+	view   *view_tree // view where a region is being selected
+	marked bool       // the mark was set for the current selection
+}
+
+func (g *godit) on_mouse(ev *termbox.Event) {
+	x, y := ev.MouseX, ev.MouseY
+	switch ev.Key {
+	case termbox.MouseWheelUp, termbox.MouseWheelDown:
+		t := g.views.leaf_at(x, y)
+		if t == nil {
+			return
+		}
+		n := mouse_wheel_lines
+		if ev.Key == termbox.MouseWheelUp {
+			n = -n
+		}
+		t.leaf.move_view_n_lines(n)
+	case termbox.MouseLeft:
+		if ev.Mod&termbox.ModMotion != 0 {
+			g.on_mouse_drag(x, y)
+		} else {
+			g.on_mouse_press(x, y)
+		}
+	case termbox.MouseRelease:
+		g.drag = mouse_drag{}
+	}
+}
+
+func (g *godit) on_mouse_press(x, y int) {
+	g.drag = mouse_drag{}
+	if s := g.views.splitter_at(x, y); s != nil {
+		g.drag.split = s
+		return
+	}
+
+	t := g.views.leaf_at(x, y)
+	if t == nil {
+		// command line
+		return
+	}
+	if t != g.active {
+		g.active.leaf.deactivate()
+		g.active = t
+		g.active.leaf.activate()
+	}
+
+	v := t.leaf
+	if y-t.Y >= v.height() {
+		// status bar
+		return
+	}
+	v.move_cursor_to_point(x-t.X, y-t.Y)
+	g.drag.view = t
+}
+
+func (g *godit) on_mouse_drag(x, y int) {
+	if s := g.drag.split; s != nil {
+		if s.left != nil {
+			s.set_split_size(x - s.X)
+		} else {
+			s.set_split_size(y - s.Y + 1)
+		}
+		return
+	}
+
+	t := g.drag.view
+	if t == nil || t != g.active {
+		return
+	}
+	v := t.leaf
+	if !g.drag.marked {
+		v.set_mark()
+		g.drag.marked = true
+	}
+
+	// dragging beyond the view scrolls it
+	vy := y - t.Y
+	if vy < 0 {
+		v.move_view_n_lines(-1)
+		vy = 0
+	} else if vy >= v.height() {
+		v.move_view_n_lines(1)
+		vy = v.height() - 1
+	}
+	v.move_cursor_to_point(x-t.X, vy)
+}
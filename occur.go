@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"regexp"
+)
+
+//----------------------------------------------------------------------------
+// occur
+//
+// Lists all the lines of a buffer matching a regexp in the *occur* buffer. RET
+// on an entry moves the cursor to the line in the source buffer. The source
+// buffer is watched, so that entries keep pointing to the right lines while
+// the source is being edited.
+//----------------------------------------------------------------------------
+
+const occur_buffer_name = "*occur*"
+
+type occur_state struct {
+	source  *buffer
+	re      *regexp.Regexp
+	pattern string
+
+	// matching lines of the source, the first one is displayed at the
+	// second line of the *occur* buffer (after the header)
+	entries []cursor_location
+}
+
+func (o *occur_state) on_insert(a *action) {
+	for i := range o.entries {
+		o.entries[i].on_insert_adjust(a)
+	}
+}
+
+func (o *occur_state) on_delete(a *action) {
+	for i := range o.entries {
+		o.entries[i].on_delete_adjust(a)
+	}
+}
+
+// Highlights the matches in the *occur* buffer, the 'line:' prefix is
+// skipped.
+func (o *occur_state) highlight(data []byte, ranges []byte_range) []byte_range {
+	i := bytes.Index(data, []byte(": "))
+	if i == -1 || o.re == nil {
+		return ranges
+	}
+	i += 2
+	for _, m := range o.re.FindAllIndex(data[i:], -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		ranges = append(ranges, byte_range{i + m[0], i + m[1]})
+	}
+	return ranges
+}
+
+func (g *godit) list_occurrences(source *buffer, pattern string) {
+	if source.name == occur_buffer_name {
+		g.set_error("Can't list occurrences in the " + occur_buffer_name + " buffer")
+		return
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		g.set_error(err.Error())
+		return
+	}
+
+	o := &g.occur
+	if o.source != nil {
+		o.source.delete_watcher(o)
+	}
+	o.source = source
+	o.re = re
+	o.pattern = pattern
+	o.entries = o.entries[:0]
+
+	var out bytes.Buffer
+	c := cursor_location{source.first_line, 1, 0}
+	for ; c.line != nil; c.line, c.line_num = c.line.next, c.line_num+1 {
+		if !re.Match(c.line.data) {
+			continue
+		}
+		o.entries = append(o.entries, c)
+		fmt.Fprintf(&out, "%6d: %s\n", c.line_num, c.line.data)
+	}
+	source.add_watcher(o)
+
+	buf := g.special_buffer(occur_buffer_name)
+	buf.on_key = g.occur_on_key
+	buf.highlight = o.highlight
+	header := fmt.Sprintf("%d matches for %q in buffer %s\n",
+		len(o.entries), pattern, source.name)
+	g.set_special_buffer_contents(buf, append([]byte(header), out.Bytes()...))
+
+	if len(o.entries) == 0 {
+		g.set_status("(No matches)")
+		return
+	}
+	g.active.leaf.attach(buf)
+}
+
+func (g *godit) occur_on_key(v *view, ev *termbox.Event) bool {
+	if ev.Mod != 0 || (ev.Key != termbox.KeyEnter && ev.Key != termbox.KeyCtrlJ) {
+		return false
+	}
+
+	o := &g.occur
+	i := v.cursor.line_num - 2
+	if i < 0 || i >= len(o.entries) {
+		g.set_status("(No occurrence on this line)")
+		return true
+	}
+	alive := false
+	for _, buf := range g.buffers {
+		alive = alive || buf == o.source
+	}
+	if !alive {
+		g.set_error("Buffer the occurrences were collected from is killed")
+		return true
+	}
+
+	v.attach(o.source)
+	v.move_cursor_to_line(o.entries[i].line_num)
+	return true
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) occur_lemp() line_edit_mode_params {
+	v := g.active.leaf
+	source := v.buf
+	word := string(v.cursor.word_under_cursor())
+	prompt := "Occur (regexp):"
+	if word != "" {
+		prompt = "Occur (regexp, default " + word + "):"
+	}
+	return line_edit_mode_params{
+		ac_decide: nil,
+		prompt:    prompt,
+		history:   "occur",
+
+		on_apply: func(buf *buffer) {
+			pattern := string(buf.contents())
+			if pattern == "" {
+				if word == "" {
+					g.set_status("(Nothing to search for)")
+					return
+				}
+				pattern = `\b` + regexp.QuoteMeta(word) + `\b`
+			}
+			g.list_occurrences(source, pattern)
+		},
+	}
+}
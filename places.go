@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//----------------------------------------------------------------------------
+// places
+//
+// Persistent database of cursor positions in files. A position is recorded
+// when a buffer is killed or on exit and it's restored when the file is
+// opened again.
+//----------------------------------------------------------------------------
+
+const (
+	places_file = "places"
+	places_max  = 1000
+)
+
+type place struct {
+	time                    int64 // unix time of the last update
+	line, boffset, top_line int
+}
+
+// The file format is line based, one place per line:
+//
+//	<time> <line> <boffset> <top line> <path>
+func load_places() (map[string]place, error) {
+	places := make(map[string]place)
+	f, err := os.Open(config_path(places_file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return places, nil
+		}
+		return places, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		parts := strings.SplitN(s.Text(), " ", 5)
+		if len(parts) != 5 {
+			return places, fmt.Errorf("%s:%d: syntax error", places_file, n)
+		}
+		t, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return places, fmt.Errorf("%s:%d: %s", places_file, n, err)
+		}
+		nums, err := atoi_all(parts[1:4])
+		if err != nil {
+			return places, fmt.Errorf("%s:%d: %s", places_file, n, err)
+		}
+		places[parts[4]] = place{t, nums[0], nums[1], nums[2]}
+	}
+	return places, s.Err()
+}
+
+func (g *godit) remember_place(buf *buffer) {
+	if buf.path == "" {
+		return
+	}
+	loc := &buf.loc
+	if len(buf.views) > 0 {
+		// 'buf.loc' is updated after each event, it lags behind the views
+		loc = &buf.views[0].view_location
+	}
+	g.places[buf.path] = place{
+		time:     time.Now().Unix(),
+		line:     loc.cursor.line_num,
+		boffset:  loc.cursor.boffset,
+		top_line: loc.top_line_num,
+	}
+}
+
+// Moves the buffer cursor to the remembered place, if there is one.
+func (g *godit) restore_place(buf *buffer) {
+	p, ok := g.places[buf.path]
+	if !ok || buf.path == "" {
+		return
+	}
+	buf.loc = buf.location_at(p.line, p.boffset, p.top_line)
+}
+
+// Records places of all opened buffers and saves the database. The file is
+// merged with the one on disk, since there can be a few godit instances
+// running at the same time.
+func (g *godit) save_places() error {
+	for _, buf := range g.buffers {
+		g.remember_place(buf)
+	}
+
+	places, err := load_places()
+	if err != nil {
+		return err
+	}
+	for path, p := range g.places {
+		if p.time >= places[path].time {
+			places[path] = p
+		}
+	}
+
+	paths := make([]string, 0, len(places))
+	for path := range places {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return places[paths[i]].time > places[paths[j]].time
+	})
+	if len(paths) > places_max {
+		paths = paths[:places_max]
+	}
+
+	f, err := create_config_file(places_file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, path := range paths {
+		p := places[path]
+		fmt.Fprintf(w, "%d %d %d %d %s\n", p.time, p.line, p.boffset,
+			p.top_line, path)
+	}
+	return w.Flush()
+}
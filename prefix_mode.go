@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+	"time"
+)
+
+//----------------------------------------------------------------------------
+// prefix mode
+//
+// Collects the keys of a key sequence after a prefix key (e.g. C-x) until
+// the sequence is bound to a command or it's clear it is not. If no key is
+// pressed for a moment, the keys which may follow are shown.
+//----------------------------------------------------------------------------
+
+const prefix_keys_delay = time.Second
+
+// Prefixes handled by their own overlay modes instead of 'prefix_mode'.
+var prefix_overlays = map[string]func(g *godit) overlay_mode{
+	view_op_prefix: func(g *godit) overlay_mode { return init_view_op_mode(g) },
+}
+
+type prefix_mode struct {
+	stub_overlay_mode
+	godit     *godit
+	keys      []key_event
+	cancel    chan struct{} // stops the popup timer
+	show_keys bool
+}
+
+func init_prefix_mode(godit *godit, keys []key_event) *prefix_mode {
+	p := &prefix_mode{godit: godit, keys: keys}
+	p.godit.echo(key_events_to_string(keys))
+	p.start_timer()
+	return p
+}
+
+func (p *prefix_mode) start_timer() {
+	g := p.godit
+	cancel := make(chan struct{})
+	p.cancel = cancel
+	go func() {
+		select {
+		case <-time.After(prefix_keys_delay):
+			g.run_async(func() {
+				p.show_keys = true
+			}, cancel)
+		case <-cancel:
+		}
+	}()
+}
+
+func (p *prefix_mode) stop_timer() {
+	if p.cancel != nil {
+		close(p.cancel)
+		p.cancel = nil
+	}
+}
+
+func (p *prefix_mode) exit() {
+	p.stop_timer()
+}
+
+func (p *prefix_mode) draw() {
+	if p.show_keys {
+		draw_prefix_keys(&p.godit.uibuf, p.keys)
+	}
+}
+
+func (p *prefix_mode) on_key(ev *termbox.Event) {
+	g := p.godit
+	keys := append(clone_key_events(p.keys), keymap_key(ev))
+	c := global_keymap.lookup(keys)
+	if c == nil && global_keymap.is_prefix(keys) {
+		if init := prefix_overlays[key_events_to_string(keys)]; init != nil {
+			g.set_overlay_mode(init(g))
+			return
+		}
+		p.keys = keys
+		g.echo(key_events_to_string(keys))
+		if !p.show_keys {
+			p.stop_timer()
+			p.start_timer()
+		}
+		return
+	}
+
+	// reset overlay mode earlier so that the command can override it
+	g.set_overlay_mode(nil)
+	if c == nil {
+		g.set_status("%s is undefined", key_events_to_string(keys))
+		return
+	}
+	g.command_keys = keys
+	g.run_command(c)
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !solaris && !openbsd && !netbsd && !freebsd
+// +build !linux,!darwin,!dragonfly,!solaris,!openbsd,!netbsd,!freebsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// no process groups, only the process itself is killed
+func set_process_group(cmd *exec.Cmd) {}
+
+func kill_process_group(p *os.Process) {
+	p.Kill()
+}
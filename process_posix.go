@@ -0,0 +1,20 @@
+//go:build linux || darwin || dragonfly || solaris || openbsd || netbsd || freebsd
+// +build linux darwin dragonfly solaris openbsd netbsd freebsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Puts the command into a new process group, so that 'kill_process_group'
+// kills the processes it spawns as well.
+func set_process_group(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func kill_process_group(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// project
+//
+// A project is a directory tree with the root marked by 'go.mod' or '.git'.
+// Files of a project are discovered with respect to '.gitignore' files.
+//----------------------------------------------------------------------------
+
+var project_root_markers = []string{"go.mod", ".git"}
+
+// Returns the nearest directory (starting from 'dir' itself) which contains
+// one of the project root markers, or 'dir' if there is no such directory.
+func find_project_root(dir string) string {
+	for d := dir; ; {
+		for _, marker := range project_root_markers {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d
+			}
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// Project root for the active buffer, its directory is used as a starting
+// point, the current directory if the buffer has no file.
+func (g *godit) project_root() string {
+	dir := "."
+	if path := g.active.leaf.buf.path; path != "" {
+		dir = filepath.Dir(path)
+	}
+	return find_project_root(abs_path(dir))
+}
+
+//----------------------------------------------------------------------------
+// gitignore
+//----------------------------------------------------------------------------
+
+type gitignore_rule struct {
+	pattern  string
+	negate   bool // '!pattern'
+	dir_only bool // 'pattern/'
+	anchored bool // contains a slash, matched against the relative path
+}
+
+func parse_gitignore(data []byte) []gitignore_rule {
+	var rules []gitignore_rule
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		s := strings.TrimRight(string(line), " \r")
+		if s == "" || s[0] == '#' {
+			continue
+		}
+
+		var r gitignore_rule
+		if s[0] == '!' {
+			r.negate = true
+			s = s[1:]
+		}
+		if strings.HasSuffix(s, "/") {
+			r.dir_only = true
+			s = strings.TrimRight(s, "/")
+		}
+		if strings.Contains(s, "/") {
+			r.anchored = true
+			s = strings.TrimLeft(s, "/")
+		}
+		if s == "" {
+			continue
+		}
+		r.pattern = s
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// 'rel' is a slash separated path relative to the .gitignore directory.
+func (r *gitignore_rule) match(rel string, is_dir bool) bool {
+	if r.dir_only && !is_dir {
+		return false
+	}
+	if r.anchored {
+		return glob_match_path(r.pattern, rel)
+	}
+	ok, _ := path.Match(r.pattern, path.Base(rel))
+	return ok
+}
+
+// Matches a slash separated path against a pattern, each path component is
+// matched with 'path.Match', except for '**', which matches any number of
+// components.
+func glob_match_path(pattern, name string) bool {
+	return glob_match_parts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func glob_match_parts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if glob_match_parts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// Ignore rules of all the .gitignore files within a tree.
+type gitignore_tree struct {
+	root  string
+	rules map[string][]gitignore_rule // directory -> rules
+}
+
+func new_gitignore_tree(root string) *gitignore_tree {
+	return &gitignore_tree{
+		root:  root,
+		rules: make(map[string][]gitignore_rule),
+	}
+}
+
+// Reads the .gitignore file of the directory 'dir', if there is one. It must
+// be called for directories before checking the files within them.
+func (t *gitignore_tree) enter(dir string) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err == nil {
+		t.rules[dir] = parse_gitignore(data)
+	}
+}
+
+// Checks the 'name' against the rules of all the parent directories, the
+// deepest matching rule wins.
+func (t *gitignore_tree) ignored(name string, is_dir bool) bool {
+	for dir := filepath.Dir(name); ; dir = filepath.Dir(dir) {
+		rules := t.rules[dir]
+		rel, err := filepath.Rel(dir, name)
+		if err == nil {
+			rel = filepath.ToSlash(rel)
+			for i := len(rules) - 1; i >= 0; i-- {
+				if rules[i].match(rel, is_dir) {
+					return !rules[i].negate
+				}
+			}
+		}
+		if dir == t.root || len(dir) <= len(t.root) {
+			break
+		}
+	}
+	return false
+}
+
+var walk_cancelled = errors.New("walk cancelled")
+
+// Walks the project tree and reports files (relative to the 'root') in
+// batches, the last batch has 'done' set. Stops early if 'cancel' is closed,
+// the last batch is not reported in that case.
+func walk_project(root string, cancel <-chan struct{}, report func(files []string, done bool)) {
+	const batch_size = 500
+	ignore := new_gitignore_tree(root)
+	batch := make([]string, 0, batch_size)
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		select {
+		case <-cancel:
+			return walk_cancelled
+		default:
+		}
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if name != root {
+				if info.Name() == ".git" || ignore.ignored(name, true) {
+					return filepath.SkipDir
+				}
+			}
+			ignore.enter(name)
+			return nil
+		}
+		if !info.Mode().IsRegular() || ignore.ignored(name, false) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return nil
+		}
+		batch = append(batch, rel)
+		if len(batch) == batch_size {
+			report(batch, false)
+			batch = make([]string, 0, batch_size)
+		}
+		return nil
+	})
+	if err != walk_cancelled {
+		report(batch, true)
+	}
+}
+
+// Opens a file of the project the active buffer belongs to, files are
+// discovered in background and filtered as they come.
+func (g *godit) find_project_file() {
+	root := g.project_root()
+	cancel := make(chan struct{})
+	m := init_fuzzy_select_mode(g, "Find file in "+abbreviate_home(root))
+	m.on_exit = func() { close(cancel) }
+	m.on_select = func(file string) {
+		buf, err := g.new_buffer_from_file(filepath.Join(root, file))
+		if err != nil {
+			return
+		}
+		g.active.leaf.attach(buf)
+	}
+	g.set_overlay_mode(m)
+
+	go walk_project(root, cancel, func(files []string, done bool) {
+		g.run_async(func() {
+			m.add_items(files, done)
+		}, cancel)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWalkProject(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":     "# comment\n*.o\n!keep.o\nbuild/\n/top.log\n",
+		".git/config":    "",
+		"main.go":        "",
+		"main.o":         "",
+		"keep.o":         "",
+		"top.log":        "",
+		"build/out.go":   "",
+		"src/build":      "", // a file, the rule is for directories only
+		"src/a.o":        "",
+		"src/top.log":    "", // the rule is anchored to the root
+		"sub/.gitignore": "*.txt\n",
+		"sub/notes.txt":  "",
+		"notes.txt":      "",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	done := false
+	walk_project(root, make(chan struct{}), func(files []string, last bool) {
+		got = append(got, files...)
+		done = last
+	})
+	if !done {
+		t.Fatal("the walk didn't finish")
+	}
+	for i := range got {
+		got[i] = filepath.ToSlash(got[i])
+	}
+	sort.Strings(got)
+	want := []string{
+		".gitignore",
+		"keep.o",
+		"main.go",
+		"notes.txt",
+		"src/build",
+		"src/top.log",
+		"sub/.gitignore",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
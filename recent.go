@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// recent files
+//
+// Persistent list of recently opened files, the most recent one is first.
+// The file is updated every time a file is opened, so that several godit
+// instances share the list.
+//----------------------------------------------------------------------------
+
+const (
+	recent_files_file = "recent"
+	recent_files_max  = 100
+)
+
+// The file format is one absolute path per line.
+func load_recent_files() ([]string, error) {
+	f, err := os.Open(config_path(recent_files_file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if path := s.Text(); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, s.Err()
+}
+
+// Moves the 'path' to the top of the recent files list.
+func add_recent_file(path string) error {
+	paths, err := load_recent_files()
+	if err != nil {
+		return err
+	}
+
+	f, err := create_config_file(recent_files_file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	w.WriteString(path + "\n")
+	n := 1
+	for _, p := range paths {
+		if n >= recent_files_max {
+			break
+		}
+		if p == path {
+			continue
+		}
+		w.WriteString(p + "\n")
+		n++
+	}
+	return w.Flush()
+}
+
+// Path with the home directory replaced by '~', for display purposes.
+func abbreviate_home(path string) string {
+	home := os.Getenv("HOME")
+	if home != "" && strings.HasPrefix(path, home+"/") {
+		return "~" + path[len(home):]
+	}
+	return path
+}
+
+func make_recent_files_ac_decide(godit *godit) ac_decide_func {
+	return func(*view) ac_func {
+		return func(view *view) ([]ac_proposal, int) {
+			paths, err := load_recent_files()
+			if err != nil {
+				godit.set_status(err.Error())
+				return nil, 0
+			}
+
+			proposals := make([]ac_proposal, 0, len(paths))
+			for _, path := range paths {
+				if _, err := os.Stat(path); err != nil {
+					continue
+				}
+				proposals = append(proposals, ac_proposal{
+					display: []byte(abbreviate_home(path)),
+					content: []byte(path),
+				})
+			}
+			return proposals, view.cursor_coffset
+		}
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) open_recent_file_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		ac_decide:      make_recent_files_ac_decide(g),
+		ac_filter:      fuzzy_ac_filter,
+		prompt:         "Recent file:",
+		init_autocompl: true,
+
+		on_apply: func(buf *buffer) {
+			path := string(buf.contents())
+			if path == "" {
+				g.set_status("(Nothing to open)")
+				return
+			}
+			b, err := g.new_buffer_from_file(path)
+			if err != nil {
+				return
+			}
+			g.active.leaf.attach(b)
+		},
+	}
+}
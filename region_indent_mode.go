@@ -29,7 +29,7 @@ func init_region_indent_mode(godit *godit, dir int) region_indent_mode {
 		bg:         termbox.ColorBlue,
 	})
 	v.dirty = dirty_everything
-	godit.set_status("(Type > or < to indent/deindent respectively)")
+	godit.echo("(Type > or < to indent/deindent respectively)")
 	return r
 }
 
@@ -47,12 +47,12 @@ func (r region_indent_mode) on_key(ev *termbox.Event) {
 		switch ev.Ch {
 		case '>':
 			v.on_vcommand(vcommand_indent_region, 0)
-			g.set_status("(Type > or < to indent/deindent respectively)")
+			g.echo("(Type > or < to indent/deindent respectively)")
 			end.boffset++
 			goto update_tag
 		case '<':
 			v.on_vcommand(vcommand_deindent_region, 0)
-			g.set_status("(Type > or < to indent/deindent respectively)")
+			g.echo("(Type > or < to indent/deindent respectively)")
 			goto update_tag
 		}
 	}
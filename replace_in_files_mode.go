@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// replace in files mode
+//
+// Goes through the matches in a set of files asking whether to replace each
+// one of them. Files are opened as buffers only if they contain matches,
+// modified buffers are left unsaved for review (see 'save_all_buffers').
+//----------------------------------------------------------------------------
+
+type replace_in_files_mode struct {
+	stub_overlay_mode
+	godit    *godit
+	word     []byte
+	repl     []byte
+	files    []string // absolute paths of the files left
+	buf      *buffer  // buffer being processed, nil before the first one
+	cur      cursor_location
+	all      bool // replace all the remaining matches without asking
+	replaced int
+	modified int // number of buffers with replacements
+	changed  bool
+	prompt   string
+}
+
+func init_replace_in_files_mode(godit *godit, files []string, word, repl []byte) *replace_in_files_mode {
+	m := new(replace_in_files_mode)
+	m.godit = godit
+	m.files = files
+	m.word = word
+	m.repl = repl
+	m.prompt = fmt.Sprintf("Replace %s with %s? (y, n, ! - all, q - quit)", word, repl)
+	return m
+}
+
+// Opens the next file with matches, returns false if there are no more.
+func (m *replace_in_files_mode) next_file() bool {
+	g := m.godit
+	for len(m.files) > 0 {
+		file := m.files[0]
+		m.files = m.files[1:]
+
+		if buf := g.find_buffer_by_full_path(file); buf == nil {
+			// don't open files without matches
+			data, err := ioutil.ReadFile(file)
+			if err != nil || !bytes.Contains(data, m.word) {
+				continue
+			}
+			head := data
+			if len(head) > grep_binary_check {
+				head = head[:grep_binary_check]
+			}
+			if bytes.IndexByte(head, 0) != -1 {
+				continue
+			}
+		}
+
+		buf, err := g.new_buffer_from_file(file)
+		if err != nil || buf.read_only {
+			continue
+		}
+		m.finish_buffer()
+		m.buf = buf
+		m.cur = cursor_location{buf.first_line, 1, 0}
+		m.changed = false
+		g.active.leaf.attach(buf)
+		return true
+	}
+	return false
+}
+
+func (m *replace_in_files_mode) finish_buffer() {
+	if m.buf == nil {
+		return
+	}
+	v := m.godit.active.leaf
+	if v.buf == m.buf {
+		v.set_tags()
+		v.highlight_bytes = nil
+		v.finalize_action_group()
+		v.dirty = dirty_everything
+	}
+	if m.changed {
+		m.modified++
+	}
+}
+
+// Moves to the next match, replacing them along the way if 'all' is set.
+// Leaves the mode when there are no more matches.
+func (m *replace_in_files_mode) next() {
+	g := m.godit
+	v := g.active.leaf
+	for {
+		if m.buf != nil && v.buf == m.buf {
+			c, ok := m.cur.search_forward(m.word)
+			if ok {
+				m.cur = c
+				if m.all {
+					m.replace()
+					continue
+				}
+				m.show_match()
+				return
+			}
+		}
+		if !m.next_file() {
+			g.set_overlay_mode(nil)
+			return
+		}
+		v = g.active.leaf
+	}
+}
+
+func (m *replace_in_files_mode) show_match() {
+	v := m.godit.active.leaf
+	end := m.cur
+	end.boffset += len(m.word)
+	v.set_tags(view_tag{
+		beg_line:   m.cur.line_num,
+		beg_offset: m.cur.boffset,
+		end_line:   m.cur.line_num,
+		end_offset: end.boffset,
+		fg:         termbox.ColorCyan,
+		bg:         termbox.ColorMagenta,
+	})
+	v.highlight_bytes = m.word
+	v.move_cursor_to(end)
+	v.center_view_on_cursor()
+	v.dirty = dirty_everything
+	m.godit.echo(m.prompt)
+}
+
+func (m *replace_in_files_mode) replace() {
+	v := m.godit.active.leaf
+	v.action_delete(m.cur, len(m.word))
+	v.action_insert(m.cur, m.repl)
+	m.cur.boffset += len(m.repl)
+	m.replaced++
+	m.changed = true
+}
+
+func (m *replace_in_files_mode) exit() {
+	m.finish_buffer()
+	m.godit.set_status("Replaced %d occurrences in %d files (C-x s saves all)",
+		m.replaced, m.modified)
+}
+
+func (m *replace_in_files_mode) on_key(ev *termbox.Event) {
+	if ev.Mod != 0 {
+		return
+	}
+	switch ev.Ch {
+	case 'y', ' ':
+		m.replace()
+	case 'n':
+		m.cur.boffset += len(m.word)
+	case '!':
+		m.all = true
+		m.replace()
+	case 'q':
+		m.godit.set_overlay_mode(nil)
+		return
+	default:
+		if ev.Key == termbox.KeyEnter || ev.Key == termbox.KeyCtrlJ {
+			m.godit.set_overlay_mode(nil)
+			return
+		}
+		m.godit.echo(m.prompt)
+		return
+	}
+	m.next()
+}
+
+// Returns absolute paths of the files of the *grep* buffer.
+func (g *godit) grep_result_files() ([]string, error) {
+	var buf *buffer
+	for _, b := range g.buffers {
+		if b.name == grep_buffer_name {
+			buf = b
+		}
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("(No grep results)")
+	}
+	var files []string
+	seen := make(map[string]bool)
+	for l := buf.first_line; l != nil; l = l.next {
+		file, _, ok := parse_grep_entry(l.data)
+		if !ok || seen[file] {
+			continue
+		}
+		seen[file] = true
+		files = append(files, filepath.Join(g.grep.root, file))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("(No grep results)")
+	}
+	return files, nil
+}
+
+// Passes absolute paths of the project files matching the glob pattern (a
+// pattern without slashes matches base names) to 'done'. An empty pattern
+// means the files of the *grep* buffer. The project is walked in background,
+// 'done' is called only if the walk wasn't cancelled (see 'stop_replace_walk').
+func (g *godit) replace_files(pattern string, done func(files []string)) {
+	g.stop_replace_walk()
+	if pattern == "" {
+		files, err := g.grep_result_files()
+		if err != nil {
+			g.set_error(err.Error())
+			return
+		}
+		done(files)
+		return
+	}
+
+	cancel := make(chan struct{})
+	g.replace_walk = cancel
+	root := g.project_root()
+	g.echo("Looking for files matching %s...", pattern)
+	go func() {
+		var files []string
+		walk_project(root, cancel, func(batch []string, last bool) {
+			for _, rel := range batch {
+				rel = filepath.ToSlash(rel)
+				ok := glob_match_path(pattern, rel)
+				if !ok && !strings.Contains(pattern, "/") {
+					ok, _ = path.Match(pattern, path.Base(rel))
+				}
+				if ok {
+					files = append(files, filepath.Join(root, rel))
+				}
+			}
+		})
+		g.run_async(func() {
+			if g.replace_walk != cancel {
+				return
+			}
+			g.replace_walk = nil
+			if len(files) == 0 {
+				g.set_error("(No files match %s)", pattern)
+				return
+			}
+			done(files)
+		}, cancel)
+	}()
+}
+
+// Cancels the project walk of 'replace_files', if there is one.
+func (g *godit) stop_replace_walk() {
+	if c := g.replace_walk; c != nil {
+		close(c)
+		g.replace_walk = nil
+	}
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) replace_in_files_lemp() line_edit_mode_params {
+	return line_edit_mode_params{
+		ac_decide: nil,
+		prompt:    "Replace in files (glob, default grep results):",
+		history:   "files",
+
+		on_apply: func(buf *buffer) {
+			g.replace_files(string(buf.contents()), func(files []string) {
+				g.set_overlay_mode(init_line_edit_mode(g,
+					g.search_and_replace_lemp1(files)))
+			})
+		},
+	}
+}
+
+// Saves all the modified buffers which have a file.
+func (g *godit) save_all_buffers() {
+	saved := 0
+	for _, buf := range g.buffers {
+		if buf.path == "" || buf.synced_with_disk() {
+			continue
+		}
+		if err := g.save_buffer(buf); err != nil {
+			g.set_error(err.Error())
+			return
+		}
+		saved++
+	}
+	if saved == 0 {
+		g.set_status("(No files need saving)")
+		return
+	}
+	g.set_status("Saved %d files", saved)
+}
+
+// Saves the buffer to its file, the buffer doesn't have to be displayed.
+func (g *godit) save_buffer(buf *buffer) error {
+	v := new_view(g.view_context(), buf)
+	v.presave_cleanup(false)
+	v.detach()
+	return buf.save()
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//----------------------------------------------------------------------------
+// sessions
+//
+// A session is a list of opened files with their cursor positions plus the
+// views layout. It is saved with C-x M-w and restored with 'godit -s' or
+// C-x M-r, after that it's saved on exit as well.
+//----------------------------------------------------------------------------
+
+const session_file = "session"
+
+// intermediate representation of the views layout
+type session_node struct {
+	split    byte // 'h', 'v' or 0 for a leaf
+	ratio    float32
+	children [2]*session_node
+
+	// leaf only
+	buffer                  int // index in the session buffers or -1
+	line, boffset, top_line int
+}
+
+type session_buffer struct {
+	path                    string
+	line, boffset, top_line int
+}
+
+// The file format is line based, empty lines and lines starting with '#' are
+// ignored, the rest looks like that:
+//
+//	buffer <line> <boffset> <top line> <path>
+//	split <h|v> <ratio>
+//	view <buffer index> <line> <boffset> <top line>
+//	active <view index>
+//
+// Split lines are followed by their two children (left and right or top and
+// bottom), views are indexed in the order of appearance.
+func (g *godit) save_session() error {
+	f, err := create_config_file(session_file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# godit session")
+	index := make(map[*buffer]int)
+	for _, buf := range g.buffers {
+		if buf.path == "" {
+			continue
+		}
+		index[buf] = len(index)
+		loc := &buf.loc
+		fmt.Fprintf(w, "buffer %d %d %d %s\n", loc.cursor.line_num,
+			loc.cursor.boffset, loc.top_line_num, buf.path)
+	}
+
+	n, active := 0, 0
+	var write_node func(t *view_tree)
+	write_node = func(t *view_tree) {
+		switch {
+		case t.leaf != nil:
+			v := t.leaf
+			bi, ok := index[v.buf]
+			if !ok {
+				bi = -1
+			}
+			fmt.Fprintf(w, "view %d %d %d %d\n", bi, v.cursor.line_num,
+				v.cursor.boffset, v.top_line_num)
+			if t == g.active {
+				active = n
+			}
+			n++
+		case t.left != nil:
+			fmt.Fprintf(w, "split h %g\n", t.split)
+			write_node(t.left)
+			write_node(t.right)
+		default:
+			fmt.Fprintf(w, "split v %g\n", t.split)
+			write_node(t.top)
+			write_node(t.bottom)
+		}
+	}
+	write_node(g.views)
+	fmt.Fprintf(w, "active %d\n", active)
+	return w.Flush()
+}
+
+func atoi_all(strs []string) ([]int, error) {
+	nums := make([]int, len(strs))
+	for i, s := range strs {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = n
+	}
+	return nums, nil
+}
+
+func load_session() (buffers []session_buffer, root *session_node, active int, err error) {
+	f, err := os.Open(config_path(session_file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errors.New("No saved session")
+		}
+		return
+	}
+	defer f.Close()
+
+	var layout [][]string
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		text := s.Text()
+		fields := strings.Fields(text)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var nums []int
+		switch {
+		case fields[0] == "buffer" && len(fields) >= 5:
+			// path is the rest of the line, it may contain spaces
+			parts := strings.SplitN(strings.TrimSpace(text), " ", 5)
+			nums, err = atoi_all(parts[1:4])
+			if err == nil {
+				buffers = append(buffers, session_buffer{
+					path:     parts[4],
+					line:     nums[0],
+					boffset:  nums[1],
+					top_line: nums[2],
+				})
+			}
+		case fields[0] == "split" && len(fields) == 3,
+			fields[0] == "view" && len(fields) == 5:
+			layout = append(layout, fields)
+		case fields[0] == "active" && len(fields) == 2:
+			active, err = strconv.Atoi(fields[1])
+		default:
+			err = errors.New("syntax error")
+		}
+		if err != nil {
+			err = fmt.Errorf("%s:%d: %s", session_file, n, err)
+			return
+		}
+	}
+	if err = s.Err(); err != nil {
+		return
+	}
+
+	var parse_node func() (*session_node, error)
+	parse_node = func() (*session_node, error) {
+		if len(layout) == 0 {
+			return nil, errors.New("incomplete views layout")
+		}
+		fields := layout[0]
+		layout = layout[1:]
+
+		node := new(session_node)
+		if fields[0] == "view" {
+			nums, err := atoi_all(fields[1:])
+			if err != nil {
+				return nil, err
+			}
+			node.buffer = nums[0]
+			node.line, node.boffset, node.top_line = nums[1], nums[2], nums[3]
+			return node, nil
+		}
+
+		if fields[1] != "h" && fields[1] != "v" {
+			return nil, errors.New("bad split: " + fields[1])
+		}
+		ratio, err := strconv.ParseFloat(fields[2], 32)
+		if err != nil {
+			return nil, err
+		}
+		node.split = fields[1][0]
+		node.ratio = float32(ratio)
+		for i := range node.children {
+			node.children[i], err = parse_node()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	}
+	root, err = parse_node()
+	if err == nil && len(layout) != 0 {
+		err = errors.New("extra views in the layout")
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %s", session_file, err)
+	}
+	return
+}
+
+// Opens the session files and replaces the current views layout with the
+// saved one. Files which don't exist anymore are skipped.
+func (g *godit) restore_session() error {
+	sbuffers, root, active, err := load_session()
+	if err != nil {
+		return err
+	}
+
+	buffers := make([]*buffer, len(sbuffers))
+	var fallback *buffer
+	for i, sb := range sbuffers {
+		if _, err := os.Stat(sb.path); err != nil {
+			continue
+		}
+		buf, err := g.new_buffer_from_file(sb.path)
+		if err != nil {
+			continue
+		}
+		buf.loc = buf.location_at(sb.line, sb.boffset, sb.top_line)
+		buffers[i] = buf
+		if fallback == nil {
+			fallback = buf
+		}
+	}
+	if fallback == nil {
+		fallback = g.buffers[0]
+	}
+
+	var leaves []*view_tree
+	var make_node func(parent *view_tree, node *session_node) *view_tree
+	make_node = func(parent *view_tree, node *session_node) *view_tree {
+		if node.split == 0 {
+			buf := fallback
+			if node.buffer >= 0 && node.buffer < len(buffers) &&
+				buffers[node.buffer] != nil {
+				buf = buffers[node.buffer]
+			}
+			v := new_view(g.view_context(), buf)
+			v.view_location = buf.location_at(node.line, node.boffset, node.top_line)
+			t := new_view_tree_leaf(parent, v)
+			leaves = append(leaves, t)
+			return t
+		}
+
+		t := &view_tree{parent: parent, split: node.ratio}
+		a := make_node(t, node.children[0])
+		b := make_node(t, node.children[1])
+		if node.split == 'h' {
+			t.left, t.right = a, b
+		} else {
+			t.top, t.bottom = a, b
+		}
+		return t
+	}
+
+	g.active.leaf.deactivate()
+	g.views.traverse(func(t *view_tree) {
+		t.leaf.detach()
+	})
+	g.views = make_node(nil, root)
+	if active < 0 || active >= len(leaves) {
+		active = 0
+	}
+	g.active = leaves[active]
+	g.active.leaf.activate()
+	g.resize()
+	return nil
+}
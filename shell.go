@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+//----------------------------------------------------------------------------
+// shell command
+//
+// Runs a shell command in background, its output (both stdout and stderr)
+// is streamed into the *shell output* buffer or, with a prefix argument, is
+// inserted at the cursor when the command finishes. C-g kills the command.
+//----------------------------------------------------------------------------
+
+const shell_output_buffer_name = "*shell output*"
+
+type shell_state struct {
+	command string
+	cancel  chan struct{} // nil if there is no command running
+	process *os.Process
+	output  *buffer // nil if the output is inserted at the cursor
+}
+
+// Starts the command, if 'v' is not nil the output is inserted there.
+func (g *godit) start_shell_command(cmdstr string, v *view) {
+	if v != nil && v.check_read_only() {
+		return
+	}
+	g.stop_shell_command()
+
+	// TODO: not portable
+	cmd := exec.Command("/bin/sh", "-c", cmdstr)
+	if path := g.active.leaf.buf.path; path != "" {
+		cmd.Dir = filepath.Dir(path)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		g.set_error(err.Error())
+		return
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	set_process_group(cmd)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		g.set_error(err.Error())
+		return
+	}
+
+	ss := &g.shell
+	ss.command = cmdstr
+	ss.process = cmd.Process
+	cancel := make(chan struct{})
+	ss.cancel = cancel
+
+	var buf, target *buffer
+	if v == nil {
+		buf = g.special_buffer(shell_output_buffer_name)
+		g.set_special_buffer_contents(buf, nil)
+		g.active.leaf.attach(buf)
+	} else {
+		target = v.buf
+		g.set_status("Running %s...", cmdstr)
+	}
+	ss.output = buf
+
+	go func() {
+		var out []byte
+		chunk := make([]byte, 4096)
+		for {
+			n, err := r.Read(chunk)
+			if n > 0 && buf != nil {
+				data := clone_byte_slice(chunk[:n])
+				g.run_async(func() {
+					if g.shell.cancel == cancel {
+						g.append_to_special_buffer(buf, data)
+					}
+				}, cancel)
+			} else if n > 0 {
+				out = append(out, chunk[:n]...)
+			}
+			if err != nil {
+				break
+			}
+		}
+		r.Close()
+		err := cmd.Wait()
+		g.run_async(func() {
+			if g.shell.cancel != cancel {
+				return // killed in the meantime
+			}
+			msg := shell_exit_message(err)
+			if v != nil && v.buf != target {
+				msg += " (the view shows another buffer, output discarded)"
+			} else if v != nil {
+				g.insert_shell_output(v, out)
+			}
+			g.finish_shell_command(msg)
+		}, cancel)
+	}()
+}
+
+func shell_exit_message(err error) string {
+	if err != nil {
+		return "Shell command failed: " + err.Error()
+	}
+	return "Shell command finished with exit status 0"
+}
+
+// Inserts the output at the cursor, the mark is set at the end of it.
+func (g *godit) insert_shell_output(v *view, out []byte) {
+	if len(out) == 0 {
+		return
+	}
+	v.finalize_action_group()
+	c := v.cursor
+	v.action_insert(c, out)
+	c.move_n_bytes_forward(out)
+	v.buf.mark = c
+	v.finalize_action_group()
+}
+
+func (g *godit) finish_shell_command(msg string) {
+	ss := &g.shell
+	if ss.cancel == nil {
+		return
+	}
+	if ss.output != nil {
+		g.append_to_special_buffer(ss.output, []byte("\n"+msg+"\n"))
+	}
+	ss.cancel = nil
+	ss.process = nil
+	ss.output = nil
+	g.set_status(msg)
+}
+
+// Kills the command in progress, if there is one.
+func (g *godit) stop_shell_command() {
+	ss := &g.shell
+	if ss.cancel == nil {
+		return
+	}
+	close(ss.cancel)
+	// the shell's children keep the output pipe open, kill them too
+	kill_process_group(ss.process)
+	g.finish_shell_command("Shell command killed")
+}
+
+// "lemp" stands for "line edit mode params"
+func (g *godit) shell_command_lemp(insert bool) line_edit_mode_params {
+	v := g.active.leaf
+	prompt := "Shell command:"
+	if insert {
+		prompt = "Shell command (insert output):"
+	} else {
+		v = nil
+	}
+	return line_edit_mode_params{
+		ac_decide: filesystem_line_ac_decide,
+		prompt:    prompt,
+		history:   "shell",
+		on_apply: func(buf *buffer) {
+			cmdstr := string(buf.contents())
+			if cmdstr == "" {
+				g.set_status("(No command)")
+				return
+			}
+			g.start_shell_command(cmdstr, v)
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+//----------------------------------------------------------------------------
+// special buffers
+//
+// Buffers like *grep* are not backed by files, they are read-only for the
+// user and their contents are managed by the editor. Such changes bypass the
+// undo history.
+//----------------------------------------------------------------------------
+
+// Handles a key in a view which displays a special buffer, returns true if
+// the key was handled and should not be passed further. It gets the keys
+// before the global keymap does, so it should leave alone what it doesn't use.
+type special_key_handler func(v *view, ev *termbox.Event) bool
+
+// Returns the ranges of the line contents to highlight, appending them to
+// 'ranges'.
+type special_highlighter func(data []byte, ranges []byte_range) []byte_range
+
+// Returns the buffer with the 'name', creates an empty read-only one if there
+// is no such buffer.
+func (g *godit) special_buffer(name string) *buffer {
+	for _, buf := range g.buffers {
+		if buf.name == name {
+			return buf
+		}
+	}
+	buf := new_empty_buffer()
+	buf.name = name
+	buf.read_only = true
+	g.buffers = append(g.buffers, buf)
+	return buf
+}
+
+// Runs 'f' with a temporary view of the buffer, which may be used to change
+// the buffer contents. The undo history is discarded afterwards.
+func (g *godit) modify_special_buffer(buf *buffer, f func(v *view)) {
+	v := new_view(g.view_context(), buf)
+	v.writes_read_only = true
+	f(v)
+	v.detach()
+	buf.init_history()
+}
+
+func (g *godit) append_to_special_buffer(buf *buffer, data []byte) {
+	g.modify_special_buffer(buf, func(v *view) {
+		end := cursor_location{buf.last_line, buf.lines_n, len(buf.last_line.data)}
+		v.action_insert(end, data)
+	})
+}
+
+// Replaces the contents of the buffer, all the views are moved to the
+// beginning of the buffer.
+func (g *godit) set_special_buffer_contents(buf *buffer, data []byte) {
+	g.modify_special_buffer(buf, func(v *view) {
+		beg := cursor_location{buf.first_line, 1, 0}
+		end := cursor_location{buf.last_line, buf.lines_n, len(buf.last_line.data)}
+		if d := beg.distance(end); d > 0 {
+			v.action_delete(beg, d)
+		}
+		v.action_insert(beg, data)
+	})
+
+	buf.mark = cursor_location{}
+	buf.loc = buf.location_at(1, 0, 1)
+	for _, v := range buf.views {
+		v.view_location = buf.loc
+		v.dirty = dirty_everything
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+//----------------------------------------------------------------------------
+// terminal
+//
+// Runs a shell on a pty in a *term* buffer. In char mode the keys (except
+// C-x, which is left for the global keys) go to the process and the cursor
+// follows the terminal one. In line mode the buffer is an ordinary read-only
+// buffer, which can be navigated and copied from using the view commands.
+//----------------------------------------------------------------------------
+
+type terminal struct {
+	godit     *godit
+	buf       *buffer
+	screen    *term_screen
+	cmd       *exec.Cmd
+	pty       *os.File
+	cancel    chan struct{}
+	line_mode bool
+	exited    bool
+}
+
+func (g *godit) start_terminal() {
+	v := g.active.leaf
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell)
+	if path := v.buf.path; path != "" {
+		cmd.Dir = filepath.Dir(path)
+	}
+	cmd.Env = append(os.Environ(), "TERM=vt100")
+	rows, cols := v.height(), v.width()
+	pty, err := start_pty(cmd, rows, cols)
+	if err != nil {
+		g.set_error(err.Error())
+		return
+	}
+
+	buf := new_empty_buffer()
+	buf.name = g.buffer_name("*term*")
+	buf.read_only = true
+	g.buffers = append(g.buffers, buf)
+	t := &terminal{
+		godit:  g,
+		buf:    buf,
+		screen: new_term_screen(rows, cols),
+		cmd:    cmd,
+		pty:    pty,
+		cancel: make(chan struct{}),
+	}
+	buf.on_key = t.on_key
+	buf.on_kill = t.kill
+	g.terms = append(g.terms, t)
+	v.attach(buf)
+	go t.read_loop()
+}
+
+func (t *terminal) read_loop() {
+	g := t.godit
+	chunk := make([]byte, 4096)
+	for {
+		n, err := t.pty.Read(chunk)
+		if n > 0 {
+			data := clone_byte_slice(chunk[:n])
+			g.run_async(func() {
+				t.output(data)
+			}, t.cancel)
+		}
+		if err != nil {
+			break
+		}
+	}
+	err := t.cmd.Wait()
+	g.run_async(func() {
+		t.exit(err)
+	}, t.cancel)
+}
+
+func (t *terminal) output(data []byte) {
+	if v := t.view(); v != nil {
+		t.resize(v)
+	}
+	t.screen.write(data)
+	t.sync()
+}
+
+func (t *terminal) exit(err error) {
+	msg := "Process finished"
+	if err != nil {
+		msg = "Process exited: " + err.Error()
+	}
+	t.exited = true
+	t.pty.Close()
+	t.screen.write([]byte("\r\n" + msg + "\r\n"))
+	t.sync()
+	t.godit.set_status("%s: %s", t.buf.name, msg)
+}
+
+// Called when the buffer is killed.
+func (t *terminal) kill() {
+	g := t.godit
+	close(t.cancel)
+	if !t.exited {
+		// the shell is a session leader (see 'start_pty'), closing the
+		// pty hangs up the jobs running in the other process groups
+		kill_process_group(t.cmd.Process)
+		t.pty.Close()
+	}
+	for i, gt := range g.terms {
+		if gt == t {
+			g.terms = append(g.terms[:i], g.terms[i+1:]...)
+			break
+		}
+	}
+}
+
+// Applies the screen changes to the buffer.
+func (t *terminal) sync() {
+	g, s, buf := t.godit, t.screen, t.buf
+	g.modify_special_buffer(buf, func(v *view) {
+		end := cursor_location{buf.last_line, buf.lines_n, len(buf.last_line.data)}
+		if s.dropped > 0 {
+			beg := cursor_location{buf.first_line, 1, 0}
+			to := end
+			if s.dropped < buf.lines_n {
+				line, line_num := buf.line_at(s.dropped + 1)
+				to = cursor_location{line, line_num, 0}
+			} else {
+				s.dirty = 0
+			}
+			v.action_delete(beg, beg.distance(to))
+		}
+		if s.dirty != -1 {
+			n := s.dirty
+			if n > buf.lines_n-1 {
+				n = buf.lines_n - 1
+			}
+			line, line_num := buf.line_at(n + 1)
+			beg := cursor_location{line, line_num, 0}
+			end = cursor_location{buf.last_line, buf.lines_n, len(buf.last_line.data)}
+			if d := beg.distance(end); d > 0 {
+				v.action_delete(beg, d)
+			}
+			v.action_insert(beg, s.text(n))
+		}
+	})
+	s.dirty = -1
+	s.dropped = 0
+	if !t.line_mode {
+		t.move_cursors()
+	}
+}
+
+// Moves the cursors of all the views to the terminal cursor.
+func (t *terminal) move_cursors() {
+	line, line_num := t.buf.line_at(t.screen.row + 1)
+	c := cursor_location{line, line_num, t.screen.cursor_boffset()}
+	if c.boffset > len(line.data) {
+		c.boffset = len(line.data)
+	}
+	for _, v := range t.buf.views {
+		v.move_cursor_to(c)
+	}
+}
+
+// The view which decides the terminal size: the active one if it shows the
+// buffer, otherwise the first one, nil if the buffer isn't displayed.
+func (t *terminal) view() *view {
+	if v := t.godit.active.leaf; v.buf == t.buf {
+		return v
+	}
+	if len(t.buf.views) > 0 {
+		return t.buf.views[0]
+	}
+	return nil
+}
+
+func (t *terminal) resize(v *view) {
+	rows, cols := v.height(), v.width()
+	if rows == t.screen.rows && cols == t.screen.cols {
+		return
+	}
+	t.screen.resize(rows, cols)
+	if !t.exited {
+		set_pty_size(t.pty, rows, cols)
+	}
+}
+
+// Whether the keys go to the process (char mode).
+func (t *terminal) takes_keys() bool {
+	return !t.line_mode && !t.exited
+}
+
+func (t *terminal) on_key(v *view, ev *termbox.Event) bool {
+	if !t.takes_keys() {
+		return false
+	}
+	if ev.Mod == 0 && ev.Ch == 0 && ev.Key == termbox.KeyCtrlX {
+		return false
+	}
+	t.resize(v)
+	if data := term_key_bytes(ev); data != nil {
+		t.pty.Write(data)
+	}
+	return true
+}
+
+var term_special_keys = map[termbox.Key]string{
+	termbox.KeyArrowUp:    "\x1b[A",
+	termbox.KeyArrowDown:  "\x1b[B",
+	termbox.KeyArrowRight: "\x1b[C",
+	termbox.KeyArrowLeft:  "\x1b[D",
+	termbox.KeyHome:       "\x1b[H",
+	termbox.KeyEnd:        "\x1b[F",
+	termbox.KeyInsert:     "\x1b[2~",
+	termbox.KeyDelete:     "\x1b[3~",
+	termbox.KeyPgup:       "\x1b[5~",
+	termbox.KeyPgdn:       "\x1b[6~",
+}
+
+// Encodes the key the way a terminal does, returns nil for the keys which
+// have no encoding (e.g. function keys).
+func term_key_bytes(ev *termbox.Event) []byte {
+	var out []byte
+	if ev.Mod&termbox.ModAlt != 0 {
+		out = append(out, 0x1b)
+	}
+	switch {
+	case ev.Ch != 0:
+		return append(out, string(ev.Ch)...)
+	case ev.Key <= termbox.KeySpace || ev.Key == termbox.KeyBackspace2:
+		// control characters are encoded as is
+		return append(out, byte(ev.Key))
+	}
+	if seq, ok := term_special_keys[ev.Key]; ok {
+		return append(out, seq...)
+	}
+	return nil
+}
+
+// Returns the terminal of the buffer, nil if it's not a terminal buffer.
+func (g *godit) terminal_of(buf *buffer) *terminal {
+	for _, t := range g.terms {
+		if t.buf == buf {
+			return t
+		}
+	}
+	return nil
+}
+
+func (g *godit) toggle_terminal_mode() {
+	t := g.terminal_of(g.active.leaf.buf)
+	if t == nil {
+		g.set_error("(Not a terminal buffer)")
+		return
+	}
+	t.line_mode = !t.line_mode
+	if t.line_mode {
+		g.set_status("Terminal line mode, C-x C-j switches back")
+		return
+	}
+	t.move_cursors()
+	g.set_status("Terminal char mode")
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// ptys are supported on linux only at the moment
+func start_pty(cmd *exec.Cmd, rows, cols int) (*os.File, error) {
+	return nil, errors.New("Terminal is not supported on this platform")
+}
+
+func set_pty_size(f *os.File, rows, cols int) error {
+	return nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+//----------------------------------------------------------------------------
+// terminal screen
+//
+// A very basic VT100 emulator: the screen is the tail of the lines (all the
+// lines above it are the scrollback), the cursor can't leave the screen.
+// Attributes, alternate screens and scrolling regions are not supported.
+//----------------------------------------------------------------------------
+
+const term_max_lines = 5000
+
+const (
+	term_ground = iota
+	term_esc
+	term_csi
+	term_osc
+	term_osc_esc
+	term_charset
+)
+
+type term_screen struct {
+	lines      [][]rune
+	row, col   int // cursor, 'row' is an index of 'lines'
+	top        int // the first line of the screen
+	rows, cols int
+
+	// changes since the last 'terminal.sync'
+	dirty   int // the first changed line, -1 if nothing has changed
+	dropped int // lines dropped from the beginning (see 'term_max_lines')
+
+	state   int
+	params  []byte
+	pending []byte // incomplete utf-8 sequence
+}
+
+func new_term_screen(rows, cols int) *term_screen {
+	return &term_screen{
+		lines: [][]rune{nil},
+		rows:  rows,
+		cols:  cols,
+		dirty: -1,
+	}
+}
+
+func (s *term_screen) mark_dirty(n int) {
+	if s.dirty == -1 || n < s.dirty {
+		s.dirty = n
+	}
+}
+
+func (s *term_screen) resize(rows, cols int) {
+	s.rows, s.cols = rows, cols
+	if s.row-s.top >= rows {
+		s.top = s.row - rows + 1
+	}
+}
+
+func (s *term_screen) write(data []byte) {
+	if len(s.pending) > 0 {
+		data = append(s.pending, data...)
+		s.pending = nil
+	}
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			s.pending = clone_byte_slice(data)
+			break
+		}
+		r, n := utf8.DecodeRune(data)
+		data = data[n:]
+		s.feed(r)
+	}
+
+	if n := len(s.lines) - term_max_lines; n > 0 {
+		s.lines = s.lines[n:]
+		s.row -= n
+		s.top -= n
+		if s.top < 0 {
+			s.top = 0
+		}
+		s.dropped += n
+		if s.dirty != -1 {
+			s.dirty -= n
+			if s.dirty < 0 {
+				s.dirty = 0
+			}
+		}
+	}
+}
+
+func (s *term_screen) feed(r rune) {
+	switch s.state {
+	case term_ground:
+		switch {
+		case r == 0x1b:
+			s.state = term_esc
+		case r == '\r':
+			s.col = 0
+		case r == '\n' || r == '\v' || r == '\f':
+			s.line_feed()
+		case r == '\b':
+			if s.col > 0 {
+				s.col--
+			}
+		case r == '\t':
+			s.col = (s.col/8 + 1) * 8
+		case r < 0x20 || r == 0x7f:
+			// bell and friends
+		default:
+			s.put(r)
+		}
+	case term_esc:
+		s.state = term_ground
+		switch r {
+		case '[':
+			s.state = term_csi
+			s.params = s.params[:0]
+		case ']':
+			s.state = term_osc
+		case '(', ')':
+			s.state = term_charset
+		case 'M':
+			// reverse index
+			if s.row > s.top {
+				s.row--
+			}
+		}
+	case term_csi:
+		if r >= 0x40 && r <= 0x7e {
+			s.state = term_ground
+			s.csi(r)
+		} else if r < utf8.RuneSelf {
+			s.params = append(s.params, byte(r))
+		}
+	case term_osc:
+		// window title and the like, terminated by BEL or ST
+		if r == 0x07 {
+			s.state = term_ground
+		} else if r == 0x1b {
+			s.state = term_osc_esc
+		}
+	case term_osc_esc, term_charset:
+		s.state = term_ground
+	}
+}
+
+func (s *term_screen) ensure_line(n int) {
+	if len(s.lines) <= n {
+		s.mark_dirty(len(s.lines))
+	}
+	for len(s.lines) <= n {
+		s.lines = append(s.lines, nil)
+	}
+}
+
+func (s *term_screen) line_feed() {
+	s.row++
+	s.ensure_line(s.row)
+	if s.row-s.top >= s.rows {
+		s.top = s.row - s.rows + 1
+	}
+}
+
+func (s *term_screen) set_row(n int) {
+	if n < s.top {
+		n = s.top
+	}
+	if s.rows > 0 && n >= s.top+s.rows {
+		n = s.top + s.rows - 1
+	}
+	s.row = n
+	s.ensure_line(n)
+}
+
+func (s *term_screen) set_col(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if s.cols > 0 && n >= s.cols {
+		n = s.cols - 1
+	}
+	s.col = n
+}
+
+// Pads the cursor line with spaces up to the 'n' column.
+func (s *term_screen) pad_line(n int) {
+	for len(s.lines[s.row]) < n {
+		s.lines[s.row] = append(s.lines[s.row], ' ')
+	}
+}
+
+func (s *term_screen) put(r rune) {
+	if s.cols > 0 && s.col >= s.cols {
+		s.col = 0
+		s.line_feed()
+	}
+	s.pad_line(s.col)
+	line := s.lines[s.row]
+	if s.col < len(line) {
+		line[s.col] = r
+	} else {
+		s.lines[s.row] = append(line, r)
+	}
+	s.col++
+	s.mark_dirty(s.row)
+}
+
+func (s *term_screen) csi(final rune) {
+	if len(s.params) > 0 && (s.params[0] < '0' || s.params[0] > ';') {
+		// private modes (e.g. "?25l")
+		return
+	}
+	var args []int
+	for _, p := range split_term_params(s.params) {
+		n, _ := strconv.Atoi(p)
+		args = append(args, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+
+	line := s.lines[s.row]
+	switch final {
+	case 'A':
+		s.set_row(s.row - arg(0, 1))
+	case 'B':
+		s.set_row(s.row + arg(0, 1))
+	case 'C':
+		s.set_col(s.col + arg(0, 1))
+	case 'D':
+		s.set_col(s.col - arg(0, 1))
+	case 'E':
+		s.set_row(s.row + arg(0, 1))
+		s.col = 0
+	case 'F':
+		s.set_row(s.row - arg(0, 1))
+		s.col = 0
+	case 'G', '`':
+		s.set_col(arg(0, 1) - 1)
+	case 'H', 'f':
+		s.set_row(s.top + arg(0, 1) - 1)
+		s.set_col(arg(1, 1) - 1)
+	case 'd':
+		s.set_row(s.top + arg(0, 1) - 1)
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+		case 1:
+			for i := 0; i <= s.col && i < len(line); i++ {
+				line[i] = ' '
+			}
+		case 2:
+			s.lines[s.row] = nil
+		}
+		s.mark_dirty(s.row)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+			s.lines = s.lines[:s.row+1]
+			s.mark_dirty(s.row)
+		case 2, 3:
+			// scroll the screen contents into the scrollback
+			n := len(s.lines)
+			for n > s.top && len(s.lines[n-1]) == 0 {
+				n--
+			}
+			s.lines = s.lines[:n]
+			s.mark_dirty(n)
+			r := s.row - s.top
+			s.top = n
+			s.row = n + r
+			s.ensure_line(s.row)
+		}
+	case 'P':
+		if s.col < len(line) {
+			n := arg(0, 1)
+			if s.col+n > len(line) {
+				n = len(line) - s.col
+			}
+			s.lines[s.row] = append(line[:s.col], line[s.col+n:]...)
+			s.mark_dirty(s.row)
+		}
+	case '@':
+		if s.col < len(line) {
+			blanks := make([]rune, arg(0, 1))
+			for i := range blanks {
+				blanks[i] = ' '
+			}
+			tail := append(blanks, line[s.col:]...)
+			s.lines[s.row] = append(line[:s.col], tail...)
+			s.mark_dirty(s.row)
+		}
+	case 'X':
+		for i, n := s.col, arg(0, 1); i < s.col+n && i < len(line); i++ {
+			line[i] = ' '
+		}
+		s.mark_dirty(s.row)
+	}
+}
+
+func split_term_params(params []byte) []string {
+	if len(params) == 0 {
+		return nil
+	}
+	var out []string
+	beg := 0
+	for i, c := range params {
+		if c == ';' {
+			out = append(out, string(params[beg:i]))
+			beg = i + 1
+		}
+	}
+	return append(out, string(params[beg:]))
+}
+
+// Returns the lines starting with 'n' joined with '\n'.
+func (s *term_screen) text(n int) []byte {
+	var out []byte
+	for i, line := range s.lines[n:] {
+		if i > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, string(line)...)
+	}
+	return out
+}
+
+// Returns the byte offset of the cursor in its line.
+func (s *term_screen) cursor_boffset() int {
+	line := s.lines[s.row]
+	if s.col < len(line) {
+		line = line[:s.col]
+	}
+	return len(string(line))
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestTermScreen(t *testing.T) {
+	cases := []struct{ input, text string }{
+		{"hello\r\nworld", "hello\nworld"},
+		{"abc\b\bX", "aXc"},
+		{"abc\x1b[2DX", "aXc"},
+		{"abcdef\r\x1b[2C\x1b[K", "ab"},
+		{"a\x1b[31mb\x1b[0mc", "abc"},
+		{"\x1b]0;title\x07prompt$ ", "prompt$ "},
+		{"1\r\n2\r\n\x1b[1;1Hx", "x\n2\n"},
+		{"abcd\x1b[1G\x1b[2P", "cd"},
+		{"abc\r\x1b[2@", "  abc"},
+		{"\xe2\x82", ""},
+	}
+	for _, c := range cases {
+		s := new_term_screen(24, 80)
+		s.write([]byte(c.input))
+		if text := string(s.text(0)); text != c.text {
+			t.Errorf("%q: expected %q, got %q", c.input, c.text, text)
+		}
+	}
+
+	// incomplete utf-8 sequences are continued by the next write
+	s := new_term_screen(24, 80)
+	s.write([]byte("\xe2\x82"))
+	s.write([]byte("\xac"))
+	if text := string(s.text(0)); text != "€" {
+		t.Errorf("expected %q, got %q", "€", text)
+	}
+
+	// the cursor stays on the screen
+	s = new_term_screen(2, 80)
+	s.write([]byte("1\r\n2\r\n3\x1b[5A"))
+	if s.row != 1 || s.top != 1 {
+		t.Errorf("expected the cursor at row 1 with top 1, got %d and %d", s.row, s.top)
+	}
+}
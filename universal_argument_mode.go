@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+	"strconv"
+)
+
+//----------------------------------------------------------------------------
+// universal argument mode
+//
+// Collects a numeric prefix argument (C-u, C-u C-u, C-u 10, M-5, etc.), the
+// first key which is not a part of the argument is executed with the count.
+//----------------------------------------------------------------------------
+
+type universal_argument_mode struct {
+	stub_overlay_mode
+	godit  *godit
+	count  int
+	digits bool // true if the count was typed in explicitly
+	done   bool // C-u after digits terminates the argument
+}
+
+func init_universal_argument_mode(godit *godit, digit int) *universal_argument_mode {
+	u := new(universal_argument_mode)
+	u.godit = godit
+	if digit < 0 {
+		u.count = 4
+	} else {
+		u.count = digit
+		u.digits = true
+	}
+	u.update_status()
+	return u
+}
+
+func (u *universal_argument_mode) update_status() {
+	u.godit.echo("C-u %s-", strconv.Itoa(u.count))
+}
+
+func (u *universal_argument_mode) on_key(ev *termbox.Event) {
+	g := u.godit
+	if ev.Key == termbox.KeyCtrlU && ev.Mod == 0 {
+		if u.digits {
+			u.done = true
+		} else {
+			u.count *= 4
+		}
+		u.update_status()
+		return
+	}
+
+	if !u.done && ev.Ch >= '0' && ev.Ch <= '9' {
+		// both '5' and 'M-5' are accepted here
+		if !u.digits {
+			u.count = 0
+			u.digits = true
+		}
+		u.count = u.count*10 + int(ev.Ch-'0')
+		u.update_status()
+		return
+	}
+
+	g.set_overlay_mode(nil)
+	g.count = u.count
+	g.on_key(ev)
+}
@@ -378,6 +378,26 @@ func substitute_home(path string) string {
 	return filepath.Join(home, path[1:])
 }
 
+// Returns the path of a godit configuration file, the file lives in
+// $XDG_CONFIG_HOME/godit (or ~/.config/godit if XDG_CONFIG_HOME is not set).
+func config_path(name string) string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = substitute_home("~/.config")
+	}
+	return filepath.Join(dir, "godit", name)
+}
+
+// Creates the configuration file for writing, making directories if necessary.
+func create_config_file(name string) (*os.File, error) {
+	path := config_path(name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
 func substitute_symlinks(path string) string {
 	if path == "" {
 		return ""
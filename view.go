@@ -6,6 +6,7 @@ import (
 	"github.com/nsf/termbox-go"
 	"github.com/nsf/tulib"
 	"os"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
@@ -35,6 +36,7 @@ type view_location struct {
 	cursor       cursor_location
 	top_line     *line
 	top_line_num int
+	top_row      int // first visible row of 'top_line' in wrap mode
 
 	// Various cursor offsets from the beginning of the line:
 	// 1. in characters
@@ -105,12 +107,35 @@ var default_view_tag = view_tag{
 	bg: termbox.ColorDefault,
 }
 
+//----------------------------------------------------------------------------
+// line numbers mode
+//----------------------------------------------------------------------------
+
+type line_numbers_mode int
+
+const (
+	line_numbers_off line_numbers_mode = iota
+	line_numbers_absolute
+	line_numbers_relative // relative to the cursor line
+)
+
+func (m line_numbers_mode) String() string {
+	switch m {
+	case line_numbers_absolute:
+		return "absolute"
+	case line_numbers_relative:
+		return "relative"
+	}
+	return "off"
+}
+
 //----------------------------------------------------------------------------
 // view context
 //----------------------------------------------------------------------------
 
 type view_context struct {
 	set_status  func(format string, args ...interface{})
+	set_error   func(format string, args ...interface{})
 	kill_buffer *[]byte
 	buffers     *[]*buffer
 }
@@ -144,9 +169,27 @@ type view struct {
 	ac               *autocompl
 	last_vcommand    vcommand
 	ac_decide        ac_decide_func
+	ac_filter        ac_filter_func
 	highlight_bytes  []byte
 	highlight_ranges []byte_range
 	tags             []view_tag
+
+	// repeat count for the next vcommand (universal argument)
+	count int
+
+	// line numbers gutter on the left side of the view
+	line_numbers line_numbers_mode
+	gutter_w     int // last known 'gutter_width', see 'update_gutter_width'
+
+	// soft line wrapping, see view_wrap.go
+	wrap            wrap_mode
+	wrap_goal_x     int // visual column kept by vertical movement, -1 if unset
+	wrap_cache      map[*line][]wrap_row
+	wrap_cache_w    int
+	wrap_cache_mode wrap_mode
+
+	// the view may change read-only buffers, see 'godit.modify_special_buffer'
+	writes_read_only bool
 }
 
 func new_view(ctx view_context, buf *buffer) *view {
@@ -157,6 +200,7 @@ func new_view(ctx view_context, buf *buffer) *view {
 	v.ac_decide = default_ac_decide
 	v.highlight_ranges = make([]byte_range, 0, 10)
 	v.tags = make([]view_tag, 0, 10)
+	v.wrap_goal_x = -1
 	return v
 }
 
@@ -180,7 +224,9 @@ func (v *view) attach(b *buffer) {
 	}
 	v.buf = b
 	v.view_location = b.loc
+	v.wrap_cache = nil
 	b.add_view(v)
+	v.update_gutter_width()
 	v.dirty = dirty_everything
 }
 
@@ -209,6 +255,7 @@ func (v *view) init_autocompl() {
 // Resize the 'v.uibuf', adjusting things accordingly.
 func (v *view) resize(w, h int) {
 	v.uibuf.Resize(w, h)
+	v.gutter_w = v.gutter_width()
 	v.adjust_line_voffset()
 	v.adjust_top_line()
 	v.dirty = dirty_everything
@@ -237,9 +284,66 @@ func (v *view) horizontal_threshold() int {
 	return view_horizontal_threshold
 }
 
+// Width of the text area, that is the view width without the line numbers
+// gutter.
 func (v *view) width() int {
-	// TODO: perhaps if I want to draw line numbers, I will hack it there
-	return v.uibuf.Width
+	return v.uibuf.Width - v.gutter_width()
+}
+
+// The gutter is as wide as the biggest line number plus one column for a
+// separator. There is no gutter if there is no room for it.
+func (v *view) gutter_width() int {
+	if v.line_numbers == line_numbers_off || v.oneline {
+		return 0
+	}
+	w := len(strconv.Itoa(v.buf.lines_n)) + 1
+	if w >= v.uibuf.Width-1 {
+		return 0
+	}
+	return w
+}
+
+func (v *view) toggle_line_numbers() {
+	v.line_numbers = (v.line_numbers + 1) % (line_numbers_relative + 1)
+	v.update_gutter_width()
+	v.dirty = dirty_everything
+	v.ctx.set_status("Line numbers: %s", v.line_numbers)
+}
+
+// The text area width depends on the gutter width, which changes when the
+// gutter is toggled or when the number of lines crosses a power of ten, in that
+// case 'line_voffset' has to be adjusted.
+func (v *view) update_gutter_width() {
+	w := v.gutter_width()
+	if w == v.gutter_w {
+		return
+	}
+	v.gutter_w = w
+	v.adjust_line_voffset()
+	v.dirty = dirty_everything
+}
+
+func (v *view) draw_line_number(line_num, coff int) {
+	n := line_num
+	fg := termbox.ColorDefault
+	if line_num == v.cursor.line_num {
+		fg = termbox.ColorYellow | termbox.AttrBold
+	} else if v.line_numbers == line_numbers_relative {
+		n = line_num - v.cursor.line_num
+		if n < 0 {
+			n = -n
+		}
+	}
+
+	s := strconv.Itoa(n)
+	x := coff + v.gutter_width() - 1 - len(s)
+	for i, r := range s {
+		v.uibuf.Cells[x+i] = termbox.Cell{
+			Ch: r,
+			Fg: fg,
+			Bg: termbox.ColorDefault,
+		}
+	}
 }
 
 func (v *view) draw_line(line *line, line_num, coff, line_voffset int) {
@@ -247,10 +351,9 @@ func (v *view) draw_line(line *line, line_num, coff, line_voffset int) {
 	tabstop := 0
 	bx := 0
 	data := line.data
+	w := v.width()
 
-	if len(v.highlight_bytes) > 0 {
-		v.find_highlight_ranges_for_line(data)
-	}
+	v.update_highlight_ranges(data)
 	for {
 		rx := x - line_voffset
 		if len(data) == 0 {
@@ -261,8 +364,8 @@ func (v *view) draw_line(line *line, line_num, coff, line_voffset int) {
 			tabstop += tabstop_length
 		}
 
-		if rx >= v.uibuf.Width {
-			last := coff + v.uibuf.Width - 1
+		if rx >= w {
+			last := coff + w - 1
 			v.uibuf.Cells[last] = termbox.Cell{
 				Ch: '>',
 				Fg: termbox.ColorDefault,
@@ -277,7 +380,7 @@ func (v *view) draw_line(line *line, line_num, coff, line_voffset int) {
 			// fill with spaces to the next tabstop
 			for ; x < tabstop; x++ {
 				rx := x - line_voffset
-				if rx >= v.uibuf.Width {
+				if rx >= w {
 					break
 				}
 
@@ -297,7 +400,7 @@ func (v *view) draw_line(line *line, line_num, coff, line_voffset int) {
 			}
 			x++
 			rx = x - line_voffset
-			if rx >= v.uibuf.Width {
+			if rx >= w {
 				break
 			}
 			if rx >= 0 {
@@ -344,19 +447,28 @@ func (v *view) draw_contents() {
 		return
 	}
 
+	if v.wrap != wrap_off {
+		v.draw_contents_wrapped()
+		return
+	}
+
 	// draw lines
 	line := v.top_line
 	coff := 0
+	gw := v.gutter_width()
 	for y, h := 0, v.height(); y < h; y++ {
 		if line == nil {
 			break
 		}
 
+		if gw != 0 {
+			v.draw_line_number(v.top_line_num+y, coff)
+		}
 		if line == v.cursor.line {
 			// special case, cursor line
-			v.draw_line(line, v.top_line_num+y, coff, v.line_voffset)
+			v.draw_line(line, v.top_line_num+y, coff+gw, v.line_voffset)
 		} else {
-			v.draw_line(line, v.top_line_num+y, coff, 0)
+			v.draw_line(line, v.top_line_num+y, coff+gw, 0)
 		}
 
 		coff += v.uibuf.Width
@@ -418,6 +530,10 @@ func (v *view) draw() {
 
 // Center view on the cursor.
 func (v *view) center_view_on_cursor() {
+	if v.wrap != wrap_off {
+		v.center_view_on_cursor_wrapped()
+		return
+	}
 	v.top_line = v.cursor.line
 	v.top_line_num = v.cursor.line_num
 	v.move_top_line_n_times(-v.height() / 2)
@@ -448,6 +564,7 @@ func (v *view) move_top_line_n_times(n int) {
 		n--
 	}
 	v.top_line = top
+	v.top_row = 0
 }
 
 // Move cursor line 'n' times forward or backward.
@@ -473,6 +590,10 @@ func (v *view) move_cursor_line_n_times(n int) {
 // When 'top_line' was changed, call this function to possibly adjust the
 // 'cursor_line'.
 func (v *view) adjust_cursor_line() {
+	if v.wrap != wrap_off {
+		v.adjust_cursor_line_wrapped()
+		return
+	}
 	vt := v.vertical_threshold()
 	cursor := v.cursor.line
 	co := v.cursor.line_num - v.top_line_num
@@ -501,6 +622,10 @@ func (v *view) adjust_cursor_line() {
 // When 'cursor_line' was changed, call this function to possibly adjust the
 // 'top_line'.
 func (v *view) adjust_top_line() {
+	if v.wrap != wrap_off {
+		v.adjust_top_line_wrapped()
+		return
+	}
 	vt := v.vertical_threshold()
 	top := v.top_line
 	co := v.cursor.line_num - v.top_line_num
@@ -520,8 +645,13 @@ func (v *view) adjust_top_line() {
 // When 'cursor_voffset' was changed usually > 0, then call this function to
 // possibly adjust 'line_voffset'.
 func (v *view) adjust_line_voffset() {
+	if v.wrap != wrap_off {
+		// no horizontal scrolling in wrap mode
+		v.line_voffset = 0
+		return
+	}
 	ht := v.horizontal_threshold()
-	w := v.uibuf.Width
+	w := v.width()
 	vo := v.line_voffset
 	cvo := v.cursor_voffset
 	threshold := w - 1
@@ -547,14 +677,23 @@ func (v *view) adjust_line_voffset() {
 }
 
 func (v *view) cursor_position() (int, int) {
+	if v.wrap != wrap_off {
+		return v.cursor_position_for(v.cursor)
+	}
 	y := v.cursor.line_num - v.top_line_num
-	x := v.cursor_voffset - v.line_voffset
+	x := v.cursor_voffset - v.line_voffset + v.gutter_width()
 	return x, y
 }
 
 func (v *view) cursor_position_for(cursor cursor_location) (int, int) {
+	if v.wrap != wrap_off {
+		vo := cursor.voffset()
+		rows := v.wrap_line(cursor.line)
+		x := vo - rows[find_wrap_row(rows, vo)].voffset
+		return x + v.gutter_width(), v.wrapped_y(cursor)
+	}
 	y := cursor.line_num - v.top_line_num
-	x := cursor.voffset() - v.line_voffset
+	x := cursor.voffset() - v.line_voffset + v.gutter_width()
 	return x, y
 }
 
@@ -578,10 +717,12 @@ func (v *view) move_cursor_to(c cursor_location) {
 
 	if c.boffset >= 0 {
 		v.last_cursor_voffset = v.cursor_voffset
+		v.wrap_goal_x = -1
 	}
 
 	if c.line != v.cursor.line {
-		if v.line_voffset != 0 {
+		if v.line_voffset != 0 || v.line_numbers != line_numbers_off {
+			// line numbers highlight the cursor line
 			v.dirty = dirty_everything
 		}
 		v.line_voffset = 0
@@ -600,11 +741,48 @@ func (v *view) move_cursor_to(c cursor_location) {
 	}
 }
 
+// Returns the buffer location displayed at the view position 'x', 'y'.
+// Positions beyond the end of a line or the buffer are clamped.
+func (v *view) location_at(x, y int) cursor_location {
+	x -= v.gutter_width()
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	if v.wrap != wrap_off {
+		return v.wrapped_location_at(y, x)
+	}
+
+	c := cursor_location{v.top_line, v.top_line_num, 0}
+	for ; y > 0 && c.line.next != nil; y-- {
+		c.line = c.line.next
+		c.line_num++
+	}
+	if c.line == v.cursor.line {
+		// only the cursor line is scrolled horizontally
+		x += v.line_voffset
+	}
+	c.boffset, _, _ = c.line.find_closest_offsets(x)
+	return c
+}
+
+// Move cursor to the view position 'x', 'y' (e.g. a mouse click), it's a
+// movement command as far as undo is concerned.
+func (v *view) move_cursor_to_point(x, y int) {
+	if v.last_vcommand.class() != vcommand_class_movement {
+		v.finalize_action_group()
+	}
+	v.last_vcommand = vcommand_move_cursor_forward
+	v.move_cursor_to(v.location_at(x, y))
+}
+
 // Move cursor one character forward.
 func (v *view) move_cursor_forward() {
 	c := v.cursor
 	if c.last_line() && c.eol() {
-		v.ctx.set_status("End of buffer")
+		v.ctx.set_error("End of buffer")
 		return
 	}
 
@@ -616,7 +794,7 @@ func (v *view) move_cursor_forward() {
 func (v *view) move_cursor_backward() {
 	c := v.cursor
 	if c.first_line() && c.bol() {
-		v.ctx.set_status("Beginning of buffer")
+		v.ctx.set_error("Beginning of buffer")
 		return
 	}
 
@@ -626,23 +804,31 @@ func (v *view) move_cursor_backward() {
 
 // Move cursor to the next line.
 func (v *view) move_cursor_next_line() {
+	if v.wrap != wrap_off {
+		v.move_cursor_next_row()
+		return
+	}
 	c := v.cursor
 	if !c.last_line() {
 		c = cursor_location{c.line.next, c.line_num + 1, -1}
 		v.move_cursor_to(c)
 	} else {
-		v.ctx.set_status("End of buffer")
+		v.ctx.set_error("End of buffer")
 	}
 }
 
 // Move cursor to the previous line.
 func (v *view) move_cursor_prev_line() {
+	if v.wrap != wrap_off {
+		v.move_cursor_prev_row()
+		return
+	}
 	c := v.cursor
 	if !c.first_line() {
 		c = cursor_location{c.line.prev, c.line_num - 1, -1}
 		v.move_cursor_to(c)
 	} else {
-		v.ctx.set_status("Beginning of buffer")
+		v.ctx.set_error("Beginning of buffer")
 	}
 }
 
@@ -678,7 +864,7 @@ func (v *view) move_cursor_word_forward() {
 	ok := c.move_one_word_forward()
 	v.move_cursor_to(c)
 	if !ok {
-		v.ctx.set_status("End of buffer")
+		v.ctx.set_error("End of buffer")
 	}
 }
 
@@ -687,12 +873,16 @@ func (v *view) move_cursor_word_backward() {
 	ok := c.move_one_word_backward()
 	v.move_cursor_to(c)
 	if !ok {
-		v.ctx.set_status("Beginning of buffer")
+		v.ctx.set_error("Beginning of buffer")
 	}
 }
 
 // Move view 'n' lines forward or backward.
 func (v *view) move_view_n_lines(n int) {
+	if v.wrap != wrap_off {
+		v.move_view_n_rows(n)
+		return
+	}
 	prevtop := v.top_line_num
 	v.move_top_line_n_times(n)
 	if prevtop != v.top_line_num {
@@ -706,6 +896,10 @@ func (v *view) can_move_top_line_n_times(n int) bool {
 	if n == 0 {
 		return true
 	}
+	if v.wrap != wrap_off {
+		_, _, _, left := v.top_moved_n_rows(n)
+		return left == 0
+	}
 
 	top := v.top_line
 	for top.prev != nil && n < 0 {
@@ -746,6 +940,15 @@ func (v *view) maybe_next_action_group() {
 }
 
 func (v *view) finalize_action_group() {
+	if v.buf.undo_lock > 0 {
+		// someone wants all the changes to be in a single group
+		return
+	}
+	v.close_action_group()
+}
+
+// Finalizes the action group even if the buffer is locked.
+func (v *view) close_action_group() {
 	b := v.buf
 	// finalize only if we're at the tip of the undo history, this function
 	// will be called mainly after each cursor movement and actions alike
@@ -760,12 +963,13 @@ func (v *view) undo() {
 	b := v.buf
 	if b.history.prev == nil {
 		// we're at the sentinel, no more things to undo
-		v.ctx.set_status("No further undo information")
+		v.ctx.set_error("No further undo information")
 		return
 	}
 
-	// undo action causes finalization, always
-	v.finalize_action_group()
+	// undo action causes finalization, always (even within a single undo
+	// group, otherwise the undone group is lost for redo)
+	v.close_action_group()
 
 	// undo invariant tells us 'len(b.history.actions) != 0' in case if this is
 	// not a sentinel, revert the actions in the current action group
@@ -783,13 +987,13 @@ func (v *view) redo() {
 	b := v.buf
 	if b.history.next == nil {
 		// open group, obviously, can't move forward
-		v.ctx.set_status("No further redo information")
+		v.ctx.set_error("No further redo information")
 		return
 	}
 	if len(b.history.next.actions) == 0 {
 		// last finalized group, moving to the next group breaks the
 		// invariant and doesn't make sense (nothing to redo)
-		v.ctx.set_status("No further redo information")
+		v.ctx.set_error("No further redo information")
 		return
 	}
 
@@ -804,7 +1008,21 @@ func (v *view) redo() {
 	v.ctx.set_status("Redo!")
 }
 
+// Reports an error if the buffer can't be changed through the view. All the
+// changes go through 'action_insert' and 'action_delete', which check it, but
+// the commands doing a series of changes should check it beforehand.
+func (v *view) check_read_only() bool {
+	if v.buf.read_only && !v.writes_read_only {
+		v.ctx.set_error("Buffer is read-only")
+		return true
+	}
+	return false
+}
+
 func (v *view) action_insert(c cursor_location, data []byte) {
+	if v.check_read_only() {
+		return
+	}
 	if v.oneline {
 		data = bytes.Replace(data, []byte{'\n'}, nil, -1)
 	}
@@ -824,6 +1042,9 @@ func (v *view) action_insert(c cursor_location, data []byte) {
 }
 
 func (v *view) action_delete(c cursor_location, nbytes int) {
+	if v.check_read_only() {
+		return
+	}
 	v.maybe_next_action_group()
 	d := c.extract_bytes(nbytes)
 	a := action{
@@ -875,7 +1096,7 @@ func (v *view) delete_rune_backward() {
 	if c.bol() {
 		if c.first_line() {
 			// beginning of the file
-			v.ctx.set_status("Beginning of buffer")
+			v.ctx.set_error("Beginning of buffer")
 			return
 		}
 		c.line = c.line.prev
@@ -902,7 +1123,7 @@ func (v *view) delete_rune() {
 	if c.eol() {
 		if c.last_line() {
 			// end of the file
-			v.ctx.set_status("End of buffer")
+			v.ctx.set_error("End of buffer")
 			return
 		}
 		v.action_delete(c, 1)
@@ -956,7 +1177,7 @@ func (v *view) kill_word_backward() {
 
 func (v *view) kill_region() {
 	if !v.buf.is_mark_set() {
-		v.ctx.set_status("The mark is not set now, so there is no region")
+		v.ctx.set_error("The mark is not set now, so there is no region")
 		return
 	}
 
@@ -1016,6 +1237,7 @@ func (v *view) on_delete_adjust_top_line(a *action) {
 				v.top_line = a.cursor.line
 				v.top_line_num = a.cursor.line_num
 			}
+			v.top_row = 0
 			v.dirty = dirty_everything
 		} else {
 			// no need to worry
@@ -1027,6 +1249,7 @@ func (v *view) on_delete_adjust_top_line(a *action) {
 
 func (v *view) on_insert(a *action) {
 	v.on_insert_adjust_top_line(a)
+	v.update_gutter_width()
 	if v.top_line_num+v.height() <= a.cursor.line_num {
 		// inserted something below the view, don't care
 		return
@@ -1049,6 +1272,7 @@ func (v *view) on_insert(a *action) {
 
 func (v *view) on_delete(a *action) {
 	v.on_delete_adjust_top_line(a)
+	v.update_gutter_width()
 	if v.top_line_num+v.height() <= a.cursor.line_num {
 		// deleted something below the view, don't care
 		return
@@ -1075,11 +1299,30 @@ func (v *view) on_delete(a *action) {
 }
 
 func (v *view) on_vcommand(cmd vcommand, arg rune) {
+	if cmd.modifies() && v.check_read_only() {
+		return
+	}
+
 	last_class := v.last_vcommand.class()
 	if cmd.class() != last_class || last_class == vcommand_class_misc {
 		v.finalize_action_group()
 	}
 
+	n := 1
+	if v.count > 1 && cmd.repeatable() {
+		n = v.count
+	}
+	v.count = 0
+
+	// repeated commands are of the same class, hence it's still one action
+	// group
+	for i := 0; i < n; i++ {
+		v.do_vcommand(cmd, arg)
+		v.last_vcommand = cmd
+	}
+}
+
+func (v *view) do_vcommand(cmd vcommand, arg rune) {
 	switch cmd {
 	case vcommand_move_cursor_forward:
 		v.move_cursor_forward()
@@ -1161,99 +1404,20 @@ func (v *view) on_vcommand(cmd vcommand, arg rune) {
 	case vcommand_word_to_lower:
 		v.word_to(bytes.ToLower)
 	}
-
-	v.last_vcommand = cmd
 }
 
 func (v *view) on_key(ev *termbox.Event) {
-	switch ev.Key {
-	case termbox.KeyCtrlF, termbox.KeyArrowRight:
-		v.on_vcommand(vcommand_move_cursor_forward, 0)
-	case termbox.KeyCtrlB, termbox.KeyArrowLeft:
-		v.on_vcommand(vcommand_move_cursor_backward, 0)
-	case termbox.KeyCtrlN, termbox.KeyArrowDown:
-		if v.ac != nil {
-			v.on_vcommand(vcommand_autocompl_move_cursor_down, 0)
-			break
-		}
-		v.on_vcommand(vcommand_move_cursor_next_line, 0)
-	case termbox.KeyCtrlP, termbox.KeyArrowUp:
-		if v.ac != nil {
-			v.on_vcommand(vcommand_autocompl_move_cursor_up, 0)
-			break
-		}
-		v.on_vcommand(vcommand_move_cursor_prev_line, 0)
-	case termbox.KeyCtrlE, termbox.KeyEnd:
-		v.on_vcommand(vcommand_move_cursor_end_of_line, 0)
-	case termbox.KeyCtrlA, termbox.KeyHome:
-		v.on_vcommand(vcommand_move_cursor_beginning_of_line, 0)
-	case termbox.KeyCtrlV, termbox.KeyPgdn:
-		v.on_vcommand(vcommand_move_view_half_forward, 0)
-	case termbox.KeyCtrlL:
-		v.on_vcommand(vcommand_recenter, 0)
-	case termbox.KeyCtrlSlash:
-		v.on_vcommand(vcommand_undo, 0)
-	case termbox.KeySpace:
-		v.on_vcommand(vcommand_insert_rune, ' ')
-	case termbox.KeyEnter, termbox.KeyCtrlJ:
-		c := '\n'
-		if ev.Key == termbox.KeyEnter {
-			// we use '\r' for <enter>, because it doesn't cause
-			// autoindent
-			c = '\r'
-		}
-		if v.ac != nil {
-			v.on_vcommand(vcommand_autocompl_finalize, 0)
-		} else {
-			v.on_vcommand(vcommand_insert_rune, c)
-		}
-	case termbox.KeyBackspace, termbox.KeyBackspace2:
-		if ev.Mod&termbox.ModAlt != 0 {
-			v.on_vcommand(vcommand_kill_word_backward, 0)
-		} else {
-			v.on_vcommand(vcommand_delete_rune_backward, 0)
-		}
-	case termbox.KeyDelete, termbox.KeyCtrlD:
-		v.on_vcommand(vcommand_delete_rune, 0)
-	case termbox.KeyCtrlK:
-		v.on_vcommand(vcommand_kill_line, 0)
-	case termbox.KeyPgup:
-		v.on_vcommand(vcommand_move_view_half_backward, 0)
-	case termbox.KeyTab:
-		v.on_vcommand(vcommand_insert_rune, '\t')
-	case termbox.KeyCtrlSpace:
-		if ev.Ch == 0 {
-			v.set_mark()
-		}
-	case termbox.KeyCtrlW:
-		v.on_vcommand(vcommand_kill_region, 0)
-	case termbox.KeyCtrlY:
-		v.on_vcommand(vcommand_yank, 0)
+	if c := view_keymap.lookup([]key_event{keymap_key(ev)}); c != nil && c.view != nil {
+		c.view(v)
+		return
 	}
 
+	// everything else inserts itself
 	if ev.Mod&termbox.ModAlt != 0 {
-		switch ev.Ch {
-		case 'v':
-			v.on_vcommand(vcommand_move_view_half_backward, 0)
-		case '<':
-			v.on_vcommand(vcommand_move_cursor_beginning_of_file, 0)
-		case '>':
-			v.on_vcommand(vcommand_move_cursor_end_of_file, 0)
-		case 'f':
-			v.on_vcommand(vcommand_move_cursor_word_forward, 0)
-		case 'b':
-			v.on_vcommand(vcommand_move_cursor_word_backward, 0)
-		case 'd':
-			v.on_vcommand(vcommand_kill_word, 0)
-		case 'w':
-			v.on_vcommand(vcommand_copy_region, 0)
-		case 'u':
-			v.on_vcommand(vcommand_word_to_upper, 0)
-		case 'l':
-			v.on_vcommand(vcommand_word_to_lower, 0)
-		case 'c':
-			v.on_vcommand(vcommand_word_to_title, 0)
-		}
+		return
+	}
+	if ev.Key == termbox.KeySpace {
+		v.on_vcommand(vcommand_insert_rune, ' ')
 	} else if ev.Ch != 0 {
 		v.on_vcommand(vcommand_insert_rune, ev.Ch)
 	}
@@ -1267,6 +1431,16 @@ func (v *view) dump_info() {
 	p("Top line num: %d\n", v.top_line_num)
 }
 
+// Highlights either the isearch word or whatever the special buffer wants.
+func (v *view) update_highlight_ranges(data []byte) {
+	switch {
+	case len(v.highlight_bytes) > 0:
+		v.find_highlight_ranges_for_line(data)
+	case v.buf.highlight != nil:
+		v.highlight_ranges = v.buf.highlight(data, v.highlight_ranges[:0])
+	}
+}
+
 func (v *view) find_highlight_ranges_for_line(data []byte) {
 	v.highlight_ranges = v.highlight_ranges[:0]
 	offset := 0
@@ -1454,7 +1628,7 @@ func (v *view) yank() {
 // shameless copy & paste from kill_region
 func (v *view) copy_region() {
 	if !v.buf.is_mark_set() {
-		v.ctx.set_status("The mark is not set now, so there is no region")
+		v.ctx.set_error("The mark is not set now, so there is no region")
 		return
 	}
 
@@ -1474,7 +1648,7 @@ func (v *view) copy_region() {
 
 func (v *view) region_to(filter func([]byte) []byte) {
 	if !v.buf.is_mark_set() {
-		v.ctx.set_status("The mark is not set now, so there is no region")
+		v.ctx.set_error("The mark is not set now, so there is no region")
 		return
 	}
 	v.filter_text(v.cursor, v.buf.mark, filter)
@@ -1569,6 +1743,9 @@ func (v *view) word_to(filter func([]byte) []byte) {
 // argument, perfect filter examples are: bytes.Title, bytes.ToUpper,
 // bytes.ToLower
 func (v *view) filter_text(from, to cursor_location, filter func([]byte) []byte) {
+	if v.check_read_only() {
+		return
+	}
 	c1, c2 := swap_cursors_maybe(from, to)
 	d := c1.distance(c2)
 	v.action_delete(c1, d)
@@ -1724,6 +1901,9 @@ func (v *view) collect_words(slice [][]byte, dups *llrb_tree, ignorecase bool) [
 
 func (v *view) search_and_replace(word, repl []byte) {
 	// assumes mark is set
+	if v.check_read_only() {
+		return
+	}
 	c1, c2 := swap_cursors_maybe(v.cursor, v.buf.mark)
 	cur := cursor_location{
 		line:     c1.line,
@@ -1884,3 +2064,41 @@ func (c vcommand) class() vcommand_class {
 	}
 	return vcommand_class_none
 }
+
+// Returns true if the command changes the buffer contents.
+func (c vcommand) modifies() bool {
+	switch c {
+	case vcommand_indent_region, vcommand_deindent_region,
+		vcommand_region_to_upper, vcommand_region_to_lower,
+		vcommand_word_to_upper, vcommand_word_to_title,
+		vcommand_word_to_lower, vcommand_autocompl_init,
+		vcommand_autocompl_finalize:
+		return true
+	}
+
+	switch c.class() {
+	case vcommand_class_insertion, vcommand_class_deletion,
+		vcommand_class_history:
+		return true
+	}
+	return false
+}
+
+// Returns true if it makes sense to repeat the command when a universal
+// argument was given.
+func (c vcommand) repeatable() bool {
+	switch c {
+	case vcommand_move_cursor_to_line, vcommand_set_mark,
+		vcommand_swap_cursor_and_mark, vcommand_recenter:
+		return false
+	case vcommand_word_to_upper, vcommand_word_to_title, vcommand_word_to_lower:
+		return true
+	}
+
+	switch c.class() {
+	case vcommand_class_movement, vcommand_class_insertion,
+		vcommand_class_deletion, vcommand_class_history:
+		return true
+	}
+	return false
+}
@@ -6,6 +6,10 @@ import (
 
 //----------------------------------------------------------------------------
 // view op mode
+//
+// Entered with the C-x C-w prefix, shows the view names, a view is selected
+// by typing its name. Other keys run the commands bound under the prefix (see
+// 'init_view_op_commands').
 //----------------------------------------------------------------------------
 
 type view_op_mode struct {
@@ -17,6 +21,10 @@ const view_names = `1234567890abcdefgijlmnpqrstuwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ`
 
 var view_op_mode_name = []byte("view operations mode")
 
+const view_op_prefix = "C-x C-w"
+
+var view_op_keys, _ = parse_key_events(view_op_prefix)
+
 func init_view_op_mode(godit *godit) view_op_mode {
 	termbox.HideCursor()
 	v := view_op_mode{godit: godit}
@@ -106,6 +114,8 @@ func (v view_op_mode) draw() {
 		Bg: termbox.ColorRed,
 		Ch: 'v',
 	})
+
+	draw_prefix_keys(&g.uibuf, view_op_keys)
 }
 
 func (v view_op_mode) select_name(ch rune) *view_tree {
@@ -131,7 +141,7 @@ func (v view_op_mode) needs_cursor() bool {
 
 func (v view_op_mode) on_key(ev *termbox.Event) {
 	g := v.godit
-	if ev.Ch != 0 {
+	if ev.Ch != 0 && ev.Mod == 0 {
 		leaf := v.select_name(ev.Ch)
 		if leaf != nil {
 			g.active.leaf.deactivate()
@@ -139,46 +149,19 @@ func (v view_op_mode) on_key(ev *termbox.Event) {
 			g.active.leaf.activate()
 			return
 		}
-
-		switch ev.Ch {
-		case 'h':
-			g.split_horizontally()
-			return
-		case 'v':
-			g.split_vertically()
-			return
-		case 'k':
-			g.kill_active_view()
-			return
-		}
 	}
 
-	switch ev.Key {
-	case termbox.KeyCtrlN, termbox.KeyArrowDown:
-		node := g.active.nearest_vsplit()
-		if node != nil {
-			node.step_resize(1)
-		}
-		return
-	case termbox.KeyCtrlP, termbox.KeyArrowUp:
-		node := g.active.nearest_vsplit()
-		if node != nil {
-			node.step_resize(-1)
-		}
-		return
-	case termbox.KeyCtrlF, termbox.KeyArrowRight:
-		node := g.active.nearest_hsplit()
-		if node != nil {
-			node.step_resize(1)
-		}
-		return
-	case termbox.KeyCtrlB, termbox.KeyArrowLeft:
-		node := g.active.nearest_hsplit()
-		if node != nil {
-			node.step_resize(-1)
-		}
+	// the commands are bound under the prefix, the mode stays active until
+	// a key which isn't bound there or until a command sets its own mode
+	keys := append(clone_key_events(view_op_keys), keymap_key(ev))
+	g.set_overlay_mode(nil)
+	c := global_keymap.lookup(keys)
+	if c == nil {
 		return
 	}
-
-	g.set_overlay_mode(nil)
+	g.command_keys = keys
+	g.run_command(c)
+	if g.overlay == nil {
+		g.set_overlay_mode(init_view_op_mode(g))
+	}
 }
@@ -171,6 +171,66 @@ func (v *view_tree) step_resize(n int) {
 	v.resize(v.Rect)
 }
 
+// Moves the splitter so that the first child gets 'n' rows (vertical split)
+// or columns (horizontal split).
+func (v *view_tree) set_split_size(n int) {
+	if v.Width <= 1 || v.Height <= 0 {
+		return
+	}
+
+	one := v.one_step()
+	v.split = one*float32(n) + (one * 0.5)
+	if v.split > 1.0 {
+		v.split = 1.0
+	}
+	if v.split < 0.0 {
+		v.split = 0.0
+	}
+	v.resize(v.Rect)
+}
+
+func (v *view_tree) contains(x, y int) bool {
+	return x >= v.X && x < v.X+v.Width && y >= v.Y && y < v.Y+v.Height
+}
+
+// Returns a leaf node which contains the screen position 'x', 'y' or nil.
+func (v *view_tree) leaf_at(x, y int) *view_tree {
+	var leaf *view_tree
+	v.traverse(func(t *view_tree) {
+		if t.contains(x, y) {
+			leaf = t
+		}
+	})
+	return leaf
+}
+
+// Returns a split node whose splitter is at the screen position 'x', 'y' or
+// nil. In case of a vertical split, the status bar of the top view acts as a
+// splitter.
+func (v *view_tree) splitter_at(x, y int) *view_tree {
+	if v.leaf != nil || !v.contains(x, y) {
+		return nil
+	}
+
+	if v.left != nil {
+		if x == v.right.X-1 {
+			return v
+		}
+		if s := v.left.splitter_at(x, y); s != nil {
+			return s
+		}
+		return v.right.splitter_at(x, y)
+	}
+
+	if y == v.bottom.Y-1 {
+		return v
+	}
+	if s := v.top.splitter_at(x, y); s != nil {
+		return s
+	}
+	return v.bottom.splitter_at(x, y)
+}
+
 func (v *view_tree) reparent() {
 	if v.left != nil {
 		v.left.parent = v
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+	"unicode/utf8"
+)
+
+//----------------------------------------------------------------------------
+// soft line wrapping
+//
+// In wrap mode a view shows each line on as many visual rows as it needs,
+// there is no horizontal scrolling ('line_voffset' is always zero). Vertical
+// cursor movement works on visual rows, while editing still works on logical
+// lines. The 'top_line' is shown starting from its 'top_row', which is
+// non-zero only when the cursor line doesn't fit into the view.
+//----------------------------------------------------------------------------
+
+type wrap_mode int
+
+const (
+	wrap_off   wrap_mode = iota
+	wrap_chars           // wrap at the view width
+	wrap_words           // wrap at word boundaries if possible
+)
+
+func (m wrap_mode) String() string {
+	switch m {
+	case wrap_chars:
+		return "on"
+	case wrap_words:
+		return "on (word boundaries)"
+	}
+	return "off"
+}
+
+// beginning of a visual row within a line
+type wrap_row struct {
+	boffset int
+	voffset int
+}
+
+// Splits a line into visual rows of 'width' cells. There is always at least
+// one row. If the last row is completely filled, an empty row is added, so
+// that the cursor at the end of the line has a place to be.
+func wrap_line(data []byte, width int, words bool) []wrap_row {
+	if width < 1 {
+		width = 1
+	}
+	rows := []wrap_row{{0, 0}}
+	row := rows[0]
+	brk := wrap_row{-1, -1} // last possible word break within the row
+	bo, vo := 0, 0
+	for bo < len(data) {
+		r, rlen := utf8.DecodeRune(data[bo:])
+		adv := rune_advance_len(r, vo)
+		if vo+adv-row.voffset > width && vo > row.voffset {
+			// the rune doesn't fit, start a new row
+			if words && brk.boffset > row.boffset {
+				row = brk
+			} else {
+				row = wrap_row{bo, vo}
+			}
+			rows = append(rows, row)
+			brk = wrap_row{-1, -1}
+			continue
+		}
+		bo += rlen
+		vo += adv
+		if r == ' ' || r == '\t' {
+			brk = wrap_row{bo, vo}
+		}
+	}
+	if vo-row.voffset >= width {
+		rows = append(rows, wrap_row{bo, vo})
+	}
+	return rows
+}
+
+// Returns the index of the row which contains the visual offset 'vo'.
+func find_wrap_row(rows []wrap_row, vo int) int {
+	i := 0
+	for i+1 < len(rows) && rows[i+1].voffset <= vo {
+		i++
+	}
+	return i
+}
+
+// Returns the byte offset in the row 'i' closest to the visual column 'x'
+// within that row. The result always stays on the row, that is it never
+// points to the beginning of the next one.
+func wrap_row_offset(data []byte, rows []wrap_row, i, x int) int {
+	beg := rows[i]
+	end := len(data)
+	last := i == len(rows)-1
+	if !last {
+		end = rows[i+1].boffset
+	}
+
+	bo, vo := beg.boffset, beg.voffset
+	for bo < end {
+		r, rlen := utf8.DecodeRune(data[bo:])
+		if !last && bo+rlen >= end {
+			break
+		}
+		adv := rune_advance_len(r, vo)
+		if vo+adv-beg.voffset > x {
+			break
+		}
+		bo += rlen
+		vo += adv
+	}
+	return bo
+}
+
+// Returns the visual rows of the line. Rows are cached per line, the cache is
+// dropped when the width or the wrap mode changes and the rows of a line are
+// dropped when an action touches it, see 'drop_wrap_rows'.
+func (v *view) wrap_line(l *line) []wrap_row {
+	w := v.width()
+	if v.wrap_cache == nil || v.wrap_cache_w != w || v.wrap_cache_mode != v.wrap {
+		v.wrap_cache = make(map[*line][]wrap_row)
+		v.wrap_cache_w = w
+		v.wrap_cache_mode = v.wrap
+	}
+	rows, ok := v.wrap_cache[l]
+	if !ok {
+		rows = wrap_line(l.data, w, v.wrap == wrap_words)
+		v.wrap_cache[l] = rows
+	}
+	return rows
+}
+
+func (v *view) wrap_rows_n(line *line) int {
+	return len(v.wrap_line(line))
+}
+
+// Drops the cached rows of the lines changed by the action.
+func (v *view) drop_wrap_rows(a *action) {
+	if v.wrap_cache == nil {
+		return
+	}
+	delete(v.wrap_cache, a.cursor.line)
+	for _, l := range a.lines {
+		delete(v.wrap_cache, l)
+	}
+}
+
+// Returns the 'top_row' clamped to the rows of the top line, the line could
+// have been changed or rewrapped since the 'top_row' was set.
+func (v *view) top_row_in(rows []wrap_row) int {
+	if v.top_row >= len(rows) {
+		return len(rows) - 1
+	}
+	return v.top_row
+}
+
+func (v *view) toggle_wrap() {
+	v.wrap = (v.wrap + 1) % (wrap_words + 1)
+	v.wrap_goal_x = -1
+	v.line_voffset = 0
+	v.top_row = 0
+	v.adjust_top_line()
+	v.dirty = dirty_everything
+	v.ctx.set_status("Line wrapping: %s", v.wrap)
+}
+
+// Visual row of the location relative to the top line. Locations which are
+// far away from the top line (more than a screen) give an approximate result,
+// which is still beyond the view.
+func (v *view) wrapped_y(c cursor_location) int {
+	h := v.height()
+	d := c.line_num - v.top_line_num
+	if d > h {
+		return h + d
+	}
+	if d < -h {
+		return d
+	}
+
+	y := -v.top_row_in(v.wrap_line(v.top_line))
+	line := v.top_line
+	for ; d > 0; d-- {
+		y += v.wrap_rows_n(line)
+		line = line.next
+	}
+	for ; d < 0; d++ {
+		line = line.prev
+		y -= v.wrap_rows_n(line)
+	}
+	return y + find_wrap_row(v.wrap_line(c.line), c.voffset())
+}
+
+// Returns a location at the visual row 'y' (relative to the top line) and the
+// visual column 'x' within that row. Rows beyond the end of the buffer give a
+// location at the last row.
+func (v *view) wrapped_location_at(y, x int) cursor_location {
+	c := cursor_location{v.top_line, v.top_line_num, 0}
+	rows := v.wrap_line(c.line)
+	y += v.top_row_in(rows)
+	for y >= len(rows) && c.line.next != nil {
+		y -= len(rows)
+		c.line = c.line.next
+		c.line_num++
+		rows = v.wrap_line(c.line)
+	}
+	if y >= len(rows) {
+		y = len(rows) - 1
+	}
+	c.boffset = wrap_row_offset(c.line.data, rows, y, x)
+	return c
+}
+
+// Visual column within the cursor row, which is preserved during vertical
+// movement.
+func (v *view) wrap_goal(rows []wrap_row, ri int) int {
+	if v.wrap_goal_x >= 0 {
+		return v.wrap_goal_x
+	}
+	return v.cursor_voffset - rows[ri].voffset
+}
+
+func (v *view) move_cursor_next_row() {
+	c := v.cursor
+	rows := v.wrap_line(c.line)
+	ri := find_wrap_row(rows, v.cursor_voffset)
+	x := v.wrap_goal(rows, ri)
+	if ri+1 < len(rows) {
+		ri++
+	} else if !c.last_line() {
+		c.line = c.line.next
+		c.line_num++
+		rows = v.wrap_line(c.line)
+		ri = 0
+	} else {
+		v.ctx.set_error("End of buffer")
+		return
+	}
+	c.boffset = wrap_row_offset(c.line.data, rows, ri, x)
+	v.move_cursor_to(c)
+	v.wrap_goal_x = x
+}
+
+func (v *view) move_cursor_prev_row() {
+	c := v.cursor
+	rows := v.wrap_line(c.line)
+	ri := find_wrap_row(rows, v.cursor_voffset)
+	x := v.wrap_goal(rows, ri)
+	if ri > 0 {
+		ri--
+	} else if !c.first_line() {
+		c.line = c.line.prev
+		c.line_num--
+		rows = v.wrap_line(c.line)
+		ri = len(rows) - 1
+	} else {
+		v.ctx.set_error("Beginning of buffer")
+		return
+	}
+	c.boffset = wrap_row_offset(c.line.data, rows, ri, x)
+	v.move_cursor_to(c)
+	v.wrap_goal_x = x
+}
+
+// Returns the top of the view moved 'n' visual rows forward or backward and the
+// number of rows left when the beginning or the end of the buffer is reached.
+func (v *view) top_moved_n_rows(n int) (top *line, top_num, row, left int) {
+	top, top_num = v.top_line, v.top_line_num
+	rows := v.wrap_rows_n(top)
+	row = v.top_row_in(v.wrap_line(top))
+	for n > 0 {
+		if row+1 < rows {
+			row++
+		} else if top.next != nil {
+			top = top.next
+			top_num++
+			rows = v.wrap_rows_n(top)
+			row = 0
+		} else {
+			break
+		}
+		n--
+	}
+	for n < 0 {
+		if row > 0 {
+			row--
+		} else if top.prev != nil {
+			top = top.prev
+			top_num--
+			rows = v.wrap_rows_n(top)
+			row = rows - 1
+		} else {
+			break
+		}
+		n++
+	}
+	return top, top_num, row, n
+}
+
+// Wrap mode version of 'move_view_n_lines', scrolls by visual rows.
+func (v *view) move_view_n_rows(n int) {
+	top, top_num, row, _ := v.top_moved_n_rows(n)
+	if top == v.top_line && row == v.top_row {
+		return
+	}
+	v.top_line = top
+	v.top_line_num = top_num
+	v.top_row = row
+	v.adjust_cursor_line()
+	v.dirty = dirty_everything
+}
+
+// Wrap mode version of 'adjust_top_line'.
+func (v *view) adjust_top_line_wrapped() {
+	vt := v.vertical_threshold()
+	h := v.height()
+	d := v.cursor.line_num - v.top_line_num
+	if d < 0 || d > h {
+		// way out of the view, start from the cursor line
+		v.top_line = v.cursor.line
+		v.top_line_num = v.cursor.line_num
+		v.top_row = 0
+		v.dirty = dirty_everything
+	}
+
+	y := v.wrapped_y(v.cursor)
+	for y >= h-vt {
+		top_row := v.top_row_in(v.wrap_line(v.top_line))
+		if v.top_line == v.cursor.line {
+			// the cursor line doesn't fit, scroll within it
+			n := y - (h - vt) + 1
+			if n > y {
+				n = y
+			}
+			v.top_row = top_row + n
+			v.dirty = dirty_everything
+			break
+		}
+		y -= v.wrap_rows_n(v.top_line) - top_row
+		v.top_line = v.top_line.next
+		v.top_line_num++
+		v.top_row = 0
+		v.dirty = dirty_everything
+	}
+	if top_row := v.top_row_in(v.wrap_line(v.top_line)); y < vt && top_row > 0 {
+		n := vt - y
+		if n > top_row {
+			n = top_row
+		}
+		v.top_row = top_row - n
+		y += n
+		v.dirty = dirty_everything
+	}
+	for y < vt && v.top_row == 0 && v.top_line.prev != nil {
+		n := v.wrap_rows_n(v.top_line.prev)
+		if y+n >= h-vt {
+			break
+		}
+		v.top_line = v.top_line.prev
+		v.top_line_num--
+		y += n
+		v.dirty = dirty_everything
+	}
+}
+
+// Wrap mode version of 'adjust_cursor_line'.
+func (v *view) adjust_cursor_line_wrapped() {
+	vt := v.vertical_threshold()
+	h := v.height()
+	y := v.wrapped_y(v.cursor)
+	target := y
+	if y < vt {
+		target = vt
+	} else if y >= h-vt {
+		target = h - vt - 1
+	}
+	if target == y {
+		return
+	}
+
+	rows := v.wrap_line(v.cursor.line)
+	x := v.wrap_goal(rows, find_wrap_row(rows, v.cursor_voffset))
+	c := v.wrapped_location_at(target, x)
+	if c == v.cursor {
+		return
+	}
+	vo, co := c.voffset_coffset()
+	v.cursor = c
+	v.cursor_coffset = co
+	v.cursor_voffset = vo
+	v.wrap_goal_x = x
+	v.dirty = dirty_everything
+}
+
+// Wrap mode version of 'center_view_on_cursor'.
+func (v *view) center_view_on_cursor_wrapped() {
+	v.top_line = v.cursor.line
+	v.top_line_num = v.cursor.line_num
+	v.top_row = 0
+	y := find_wrap_row(v.wrap_line(v.cursor.line), v.cursor_voffset)
+	if y > v.height()/2 {
+		// the cursor is deep within a long line
+		v.top_row = y - v.height()/2
+		y = v.height() / 2
+	}
+	for v.top_line.prev != nil {
+		n := v.wrap_rows_n(v.top_line.prev)
+		if y+n > v.height()/2 {
+			break
+		}
+		v.top_line = v.top_line.prev
+		v.top_line_num--
+		y += n
+	}
+	v.dirty = dirty_everything
+}
+
+// Wrap mode version of 'draw_contents' main loop.
+func (v *view) draw_contents_wrapped() {
+	line := v.top_line
+	line_num := v.top_line_num
+	gw := v.gutter_width()
+	for y, h := 0, v.height(); y < h && line != nil; line_num++ {
+		v.update_highlight_ranges(line.data)
+		rows := v.wrap_line(line)
+		i := 0
+		if line == v.top_line {
+			i = v.top_row_in(rows)
+		}
+		for ; i < len(rows) && y < h; i++ {
+			coff := y * v.uibuf.Width
+			if gw != 0 && i == 0 {
+				v.draw_line_number(line_num, coff)
+			}
+			v.draw_wrapped_row(line, line_num, coff+gw, rows, i)
+			y++
+		}
+		line = line.next
+	}
+}
+
+// Draws the row 'i' of a wrapped line, see 'draw_line' for the details.
+func (v *view) draw_wrapped_row(line *line, line_num, coff int, rows []wrap_row, i int) {
+	data := line.data
+	end := len(data)
+	if i+1 < len(rows) {
+		end = rows[i+1].boffset
+	}
+	w := v.width()
+	bx, vo := rows[i].boffset, rows[i].voffset
+	for bx < end {
+		x := vo - rows[i].voffset
+		r, rlen := utf8.DecodeRune(data[bx:])
+		adv := rune_advance_len(r, vo)
+		switch {
+		case r == '\t':
+			for j := 0; j < adv && x+j < w; j++ {
+				v.uibuf.Cells[coff+x+j] = v.make_cell(line_num, bx, ' ')
+			}
+		case r < 32:
+			// invisible chars like ^R or ^@
+			v.uibuf.Cells[coff+x] = termbox.Cell{
+				Ch: '^',
+				Fg: termbox.ColorRed,
+				Bg: termbox.ColorDefault,
+			}
+			if x+1 < w {
+				v.uibuf.Cells[coff+x+1] = termbox.Cell{
+					Ch: invisible_rune_table[r],
+					Fg: termbox.ColorRed,
+					Bg: termbox.ColorDefault,
+				}
+			}
+		default:
+			v.uibuf.Cells[coff+x] = v.make_cell(line_num, bx, r)
+		}
+		bx += rlen
+		vo += adv
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrapLongLineCursorVisible(t *testing.T) {
+	const w, h = 10, 5 // 4 rows of contents, the last one is the status
+	long := strings.Repeat("0123456789abcdefghij", 5)
+	buf, err := new_buffer(bytes.NewBufferString("short\n" + long + "\nend\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := new_view(view_context{
+		set_status: func(string, ...interface{}) {},
+		set_error:  func(string, ...interface{}) {},
+	}, buf)
+	v.resize(w, h)
+	v.wrap = wrap_chars
+
+	check := func(step int) {
+		x, y := v.cursor_position()
+		if y < 0 || y >= v.height() {
+			t.Fatalf("step %d: cursor row %d is out of the view", step, y)
+		}
+		v.draw_contents()
+		data := v.cursor.line.data
+		if v.cursor.boffset < len(data) {
+			want := rune(data[v.cursor.boffset])
+			if got := v.uibuf.Cells[y*w+x].Ch; got != want {
+				t.Fatalf("step %d: expected %q under the cursor, got %q",
+					step, want, got)
+			}
+		}
+	}
+	rows := len(wrap_line([]byte(long), w, false))
+	for i := 0; i < rows+2; i++ {
+		v.move_cursor_next_line()
+		check(i)
+	}
+	for i := 0; i < rows+2; i++ {
+		v.move_cursor_prev_line()
+		check(rows + 2 + i)
+	}
+
+	v.move_cursor_to_line(2)
+	v.move_cursor_end_of_line()
+	v.center_view_on_cursor()
+	check(-1)
+}
+
+func TestWrapScrollByRows(t *testing.T) {
+	const w, h = 10, 5
+	long := strings.Repeat("0123456789", 8)
+	buf, err := new_buffer(bytes.NewBufferString(long + "\nend\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := new_view(view_context{
+		set_status: func(string, ...interface{}) {},
+		set_error:  func(string, ...interface{}) {},
+	}, buf)
+	v.resize(w, h)
+	v.wrap = wrap_chars
+
+	v.on_vcommand(vcommand_move_view_half_forward, 0)
+	if v.top_line != buf.first_line || v.top_row != v.height()/2 {
+		t.Fatalf("expected to scroll within the first line, got line %d row %d",
+			v.top_line_num, v.top_row)
+	}
+	if _, y := v.cursor_position(); y < 0 || y >= v.height() {
+		t.Fatalf("cursor row %d is out of the view", y)
+	}
+	v.on_vcommand(vcommand_move_view_half_backward, 0)
+	if v.top_row != 0 {
+		t.Fatalf("expected to scroll back to the first row, got %d", v.top_row)
+	}
+
+	// cached rows are dropped when the line changes
+	n := v.wrap_rows_n(buf.first_line)
+	v.action_insert(cursor_location{buf.first_line, 1, 0}, []byte(long[:w]))
+	if got := v.wrap_rows_n(buf.first_line); got != n+1 {
+		t.Fatalf("expected %d rows after the insertion, got %d", n+1, got)
+	}
+}